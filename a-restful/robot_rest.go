@@ -0,0 +1,940 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"robot_challenge/b-librobot/librobot"
+)
+
+// Task status values reported by the status endpoint
+const (
+	StatusQueued      = string(librobot.TaskQueued)
+	StatusRunning     = string(librobot.TaskRunning)
+	StatusCompleted   = string(librobot.TaskCompleted)
+	StatusFailed      = string(librobot.TaskFailed)
+	StatusCancelled   = string(librobot.TaskCancelled)
+	StatusInterrupted = string(librobot.TaskInterrupted)
+)
+
+// server wraps a librobot.CrateWarehouse and exposes it to ground control over HTTP
+type server struct {
+	warehouse librobot.CrateWarehouse
+	mu        sync.Mutex                // Mutex to protect robots and tasks
+	robots    map[string]librobot.Robot // Map of robots to user defined robot IDs
+	tasks     map[string]*taskRecord    // Map of task ID to the task record
+	pending   map[string][]*taskRecord  // Unfinished tasks for each robot in the order they were submitted
+	hooks     *webhookNotifier          // Notifies ground control when tasks finish
+	stream    *streamHub                // Fans out live events to dashboards
+	tracking  sync.WaitGroup            // Tracks tasks being followed until they finish
+
+	unsubscribe func() // Stops relaying the warehouse's events to the stream
+}
+
+// taskRecord tracks a command series submitted through the API
+type taskRecord struct {
+	ID       string              `json:"task_id"`
+	RobotID  string              `json:"robot_id"`
+	Commands string              `json:"commands"`
+	Priority int                 `json:"priority,omitempty"`
+	Status   string              `json:"status"`
+	State    librobot.RobotState `json:"state"`           // Last reported robot state
+	Error    string              `json:"error,omitempty"` // Reason the task failed, if any
+	Callback string              `json:"callback_url,omitempty"`
+
+	projected librobot.RobotState // Robot state once the task has completed; used to plan moves
+}
+
+// taskStatusResponse is returned by GET /robots/{id}/tasks/{taskID}
+type taskStatusResponse struct {
+	ID               string              `json:"task_id"`
+	RobotID          string              `json:"robot_id"`
+	Commands         string              `json:"commands"`
+	Priority         int                 `json:"priority"`
+	Status           string              `json:"status"`
+	State            librobot.RobotState `json:"state"` // Last reported robot state
+	TotalCommands    int                 `json:"total_commands"`
+	CommandsExecuted int                 `json:"commands_executed"`
+	FailedCommand    string              `json:"failed_command,omitempty"`
+	Error            string              `json:"error,omitempty"`
+	QueuedAt         time.Time           `json:"queued_at"`
+	StartedAt        *time.Time          `json:"started_at,omitempty"`
+	EndedAt          *time.Time          `json:"ended_at,omitempty"`
+}
+
+// robotRequest is the body accepted by POST /robots
+type robotRequest struct {
+	ID       string `json:"id"`
+	X        uint   `json:"x"`
+	Y        uint   `json:"y"`
+	Diagonal bool   `json:"diagonal"`
+}
+
+// robotResponse describes a robot and its current state
+type robotResponse struct {
+	ID    string              `json:"id"`
+	State librobot.RobotState `json:"state"`
+}
+
+// taskRequest is the body accepted by POST /robots/{id}/tasks
+type taskRequest struct {
+	Commands    string `json:"commands"`
+	CallbackURL string `json:"callback_url,omitempty"` // Notified when this task finishes
+	Priority    int    `json:"priority,omitempty"`     // Higher priorities run first
+	Preempt     string `json:"preempt,omitempty"`      // "suspend" or "abort" a running task of lower priority
+	Front       bool   `json:"front,omitempty"`        // Put the task at the front of the queue whatever its priority
+}
+
+// moveRequest is the body accepted by POST /robots/{id}/move
+type moveRequest struct {
+	X           uint   `json:"x"`
+	Y           uint   `json:"y"`
+	CallbackURL string `json:"callback_url,omitempty"` // Notified when this task finishes
+	Priority    int    `json:"priority,omitempty"`     // Higher priorities run first
+	Preempt     string `json:"preempt,omitempty"`      // "suspend" or "abort" a running task of lower priority
+	Front       bool   `json:"front,omitempty"`        // Put the task at the front of the queue whatever its priority
+}
+
+// reorderRequest is the body accepted by PUT /robots/{id}/queue
+type reorderRequest struct {
+	TaskIDs []string `json:"task_ids"` // Queued tasks to move to the front of the queue, in order
+}
+
+// clearResponse is returned by DELETE /robots/{id}/queue
+type clearResponse struct {
+	Cancelled []string `json:"cancelled"` // IDs of the cancelled tasks
+}
+
+// validateResponse is returned by POST /robots/{id}/validate
+type validateResponse struct {
+	Valid         bool                  `json:"valid"`
+	Start         librobot.RobotState   `json:"start"`       // Robot state once its queued tasks are done
+	Path          []librobot.RobotState `json:"path"`        // Robot state after each command predicted to succeed
+	Final         librobot.RobotState   `json:"final_state"` // Predicted robot state at the end of the series
+	FailedCommand string                `json:"failed_command,omitempty"`
+	FailedIndex   int                   `json:"failed_index"` // Index of the failed command, or -1
+	Error         string                `json:"error,omitempty"`
+}
+
+// crateRequest is the body accepted by POST /crates
+type crateRequest struct {
+	X uint `json:"x"`
+	Y uint `json:"y"`
+}
+
+// newServer creates a server around the given warehouse.
+// Webhook payloads are signed with secret.
+func newServer(w librobot.CrateWarehouse, secret []byte) *server {
+	s := &server{
+		warehouse: w,
+		robots:    make(map[string]librobot.Robot),
+		tasks:     make(map[string]*taskRecord),
+		pending:   make(map[string][]*taskRecord),
+		hooks:     newWebhookNotifier(secret),
+		stream:    newStreamHub(),
+	}
+	// The stream relays the warehouse's own events until the server is closed
+	events, unsubscribe := w.Subscribe()
+	s.unsubscribe = unsubscribe
+	go s.stream.forward(events)
+	return s
+}
+
+// routes registers the API handlers and returns the resulting handler.
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /robots", s.handleListRobots)
+	mux.HandleFunc("POST /robots", s.handleAddRobot)
+	mux.HandleFunc("GET /robots/{id}", s.handleGetRobot)
+	mux.HandleFunc("DELETE /robots/{id}", s.handleRemoveRobot)
+	mux.HandleFunc("POST /robots/{id}/tasks", s.handleEnqueueTask)
+	mux.HandleFunc("POST /robots/{id}/move", s.handleMoveTo)
+	mux.HandleFunc("POST /robots/{id}/validate", s.handleValidateTask)
+	mux.HandleFunc("GET /robots/{id}/tasks/{taskID}", s.handleTaskStatus)
+	mux.HandleFunc("DELETE /robots/{id}/tasks/{taskID}", s.handleCancelTask)
+	mux.HandleFunc("GET /robots/{id}/queue", s.handleListQueue)
+	mux.HandleFunc("PUT /robots/{id}/queue", s.handleReorderQueue)
+	mux.HandleFunc("DELETE /robots/{id}/queue", s.handleClearQueue)
+	mux.HandleFunc("POST /robots/{id}/pause", s.handlePauseRobot)
+	mux.HandleFunc("POST /robots/{id}/resume", s.handleResumeRobot)
+	mux.HandleFunc("POST /pause", s.handlePause)
+	mux.HandleFunc("POST /resume", s.handleResume)
+	mux.HandleFunc("GET /estop", s.handleGetIncident)
+	mux.HandleFunc("POST /estop", s.handleEmergencyStop)
+	mux.HandleFunc("DELETE /estop", s.handleReset)
+	mux.HandleFunc("POST /crates", s.handleAddCrate)
+	mux.HandleFunc("DELETE /crates/{x}/{y}", s.handleDelCrate)
+	mux.HandleFunc("GET /chargers", s.handleListChargers)
+	mux.HandleFunc("POST /chargers", s.handleAddCharger)
+	mux.HandleFunc("DELETE /chargers/{x}/{y}", s.handleDelCharger)
+	mux.HandleFunc("GET /webhooks", s.handleListWebhooks)
+	mux.HandleFunc("POST /webhooks", s.handleAddWebhook)
+	mux.HandleFunc("DELETE /webhooks/{hookID}", s.handleDelWebhook)
+	mux.HandleFunc("GET /events", s.handleEventStream)
+	mux.HandleFunc("GET /ws", s.handleWebSocket)
+	return mux
+}
+
+// handleListRobots returns every robot and its current state.
+func (s *server) handleListRobots(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	resp := make([]robotResponse, 0, len(s.robots))
+	for id, robot := range s.robots {
+		resp = append(resp, robotResponse{ID: id, State: robot.CurrentState()})
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAddRobot adds a new robot to the warehouse.
+func (s *server) handleAddRobot(w http.ResponseWriter, r *http.Request) {
+	var req robotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if req.ID == "" {
+		writeError(w, http.StatusBadRequest, errors.New("robot id is required"))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.robots[req.ID]; ok {
+		writeError(w, http.StatusConflict, fmt.Errorf("robot '%s' already exists", req.ID))
+		return
+	}
+
+	add := librobot.AddRobot
+	if req.Diagonal {
+		add = librobot.AddDiagonalRobot
+	}
+	robot, err := add(s.warehouse, req.X, req.Y, req.ID)
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	s.robots[req.ID] = robot
+	writeJSON(w, http.StatusCreated, robotResponse{ID: req.ID, State: robot.CurrentState()})
+}
+
+// handleGetRobot returns the current state of a single robot.
+func (s *server) handleGetRobot(w http.ResponseWriter, r *http.Request) {
+	robot, ok := s.robot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, robotResponse{ID: r.PathValue("id"), State: robot.CurrentState()})
+}
+
+// handleRemoveRobot removes a robot from the warehouse. Its tasks are cancelled, unless drain=true is given,
+// in which case the request waits for the robot to finish them. A robot carrying a crate is only removed
+// if drop_crate=true is given, and drops the crate where it stands.
+func (s *server) handleRemoveRobot(w http.ResponseWriter, r *http.Request) {
+	robotID := r.PathValue("id")
+	if _, ok := s.robot(robotID); !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+
+	var policy librobot.RemovalPolicy
+	query := r.URL.Query()
+	for name, option := range map[string]*bool{"drain": &policy.Drain, "drop_crate": &policy.DropCrate} {
+		if value := query.Get(name); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %q", name, value))
+				return
+			}
+			*option = b
+		}
+	}
+
+	// The server mutex is not held while a draining robot finishes its tasks. If the client gives up first,
+	// the robot's remaining tasks are cancelled and it is removed all the same.
+	err := librobot.RemoveRobotContext(r.Context(), s.warehouse, robotID, policy)
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		if errors.Is(err, librobot.ErrRobotNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	s.mu.Lock()
+	delete(s.robots, robotID)
+	delete(s.pending, robotID)
+	for taskID, rec := range s.tasks {
+		if rec.RobotID == robotID {
+			delete(s.tasks, taskID) // The robot's task records went with it
+		}
+	}
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEnqueueTask validates a command series and sends it to the robot.
+// The series is dry-run with Robot.Simulate, and series with a move which cannot succeed are rejected before they
+// reach the robot. Predicted crate and charging failures are left to the robot, as the crates may have moved by then.
+func (s *server) handleEnqueueTask(w http.ResponseWriter, r *http.Request) {
+	robotID := r.PathValue("id")
+	var req taskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	opts, err := taskOptions(req.Priority, req.Preempt, req.Front)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	robot, ok := s.robots[robotID]
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+
+	// Check from where the robot will be once its earlier tasks are done
+	sim, err := robot.Simulate(req.Commands)
+	var parseErr *librobot.ParseError
+	switch {
+	case errors.As(err, &parseErr):
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	case errors.Is(err, librobot.ErrOutOfBounds), errors.Is(err, librobot.ErrObstacle), errors.Is(err, librobot.ErrBatteryDepleted):
+		writeError(w, http.StatusUnprocessableEntity, fmt.Errorf("command %d '%c': %w", sim.FailedIndex, sim.FailedCommand, err))
+		return
+	}
+
+	taskID, posCh, errCh := robot.EnqueueTask(req.Commands, opts...)
+	if taskID == "" {
+		// The robot is being removed, or its queue is full
+		err := <-errCh
+		writeError(w, rejectedStatus(err, http.StatusConflict), err)
+		return
+	}
+	rec := &taskRecord{
+		ID:        taskID,
+		RobotID:   robotID,
+		Commands:  req.Commands,
+		Priority:  req.Priority,
+		Status:    StatusQueued,
+		State:     sim.Start,
+		Callback:  req.CallbackURL,
+		projected: sim.Final,
+	}
+	s.startTracking(rec, posCh, errCh)
+
+	writeJSON(w, http.StatusAccepted, rec)
+}
+
+// handleMoveTo plans a path to the requested position and sends it to the robot as a command series.
+// The generated commands are returned in the task record.
+func (s *server) handleMoveTo(w http.ResponseWriter, r *http.Request) {
+	robotID := r.PathValue("id")
+	var req moveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(req.CallbackURL); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	opts, err := taskOptions(req.Priority, req.Preempt, req.Front)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	robot, ok := s.robots[robotID]
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+
+	start := s.projectedState(robotID, robot)
+	taskID, commands, posCh, errCh := robot.MoveTo(req.X, req.Y, opts...)
+	if taskID == "" {
+		err := <-errCh
+		writeError(w, rejectedStatus(err, http.StatusUnprocessableEntity), err)
+		return
+	}
+	rec := &taskRecord{
+		ID:        taskID,
+		RobotID:   robotID,
+		Commands:  commands,
+		Priority:  req.Priority,
+		Status:    StatusQueued,
+		State:     start,
+		Callback:  req.CallbackURL,
+		projected: librobot.RobotState{X: req.X, Y: req.Y, HasCrate: start.HasCrate},
+	}
+	s.startTracking(rec, posCh, errCh)
+
+	writeJSON(w, http.StatusAccepted, rec)
+}
+
+// taskOptions converts the priority, preemption mode and queue position of a request into task options.
+func taskOptions(priority int, preempt string, front bool) ([]librobot.TaskOption, error) {
+	opts := []librobot.TaskOption{librobot.WithTaskPriority(librobot.TaskPriority(priority))}
+	switch mode := librobot.PreemptionMode(preempt); mode {
+	case librobot.PreemptNone:
+	case librobot.PreemptSuspend, librobot.PreemptAbort:
+		opts = append(opts, librobot.WithPreemption(mode))
+	default:
+		return nil, fmt.Errorf("unknown preemption mode %q; use \"suspend\" or \"abort\"", preempt)
+	}
+	if front {
+		opts = append(opts, librobot.WithQueueFront())
+	}
+	return opts, nil
+}
+
+// rejectedStatus returns the HTTP status for a task the robot would not queue.
+// A full queue is 429 Too Many Requests and an emergency stop is 503 Service Unavailable; other errors get the given status.
+func rejectedStatus(err error, status int) int {
+	switch {
+	case errors.Is(err, librobot.ErrQueueFull):
+		return http.StatusTooManyRequests
+	case errors.Is(err, librobot.ErrEmergencyStop):
+		return http.StatusServiceUnavailable
+	}
+	return status
+}
+
+// projectedState returns where the robot will be once its pending tasks are done. The server mutex must be held.
+// Tasks are assumed to run in the order they were submitted, although a task of higher priority may run earlier.
+func (s *server) projectedState(robotID string, robot librobot.Robot) librobot.RobotState {
+	if queue := s.pending[robotID]; len(queue) > 0 {
+		return queue[len(queue)-1].projected
+	}
+	return robot.CurrentState()
+}
+
+// startTracking records a task sent to a robot and follows its progress. The server mutex must be held.
+func (s *server) startTracking(rec *taskRecord, posCh chan librobot.RobotState, errCh chan error) {
+	s.tasks[rec.ID] = rec
+	s.pending[rec.RobotID] = append(s.pending[rec.RobotID], rec)
+	s.tracking.Add(1)
+	go func() {
+		defer s.tracking.Done()
+		s.track(rec, posCh, errCh)
+	}()
+}
+
+// handleValidateTask dry-runs a command series against the robot's projected position and the current crates.
+// The series is not sent to the robot. Predicted failures are reported with valid set to false.
+func (s *server) handleValidateTask(w http.ResponseWriter, r *http.Request) {
+	var req taskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	robot, ok := s.robot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+
+	sim, err := robot.Simulate(req.Commands)
+	resp := validateResponse{
+		Valid:       err == nil,
+		Start:       sim.Start,
+		Path:        sim.Path,
+		Final:       sim.Final,
+		FailedIndex: sim.FailedIndex,
+	}
+	if resp.Path == nil {
+		resp.Path = []librobot.RobotState{}
+	}
+	if sim.FailedCommand != 0 {
+		resp.FailedCommand = string(sim.FailedCommand)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleTaskStatus reports the execution status of a command series, as recorded by the robot.
+func (s *server) handleTaskStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	taskID := r.PathValue("taskID")
+	rec, ok := s.tasks[taskID]
+	if !ok || rec.RobotID != r.PathValue("id") {
+		writeError(w, http.StatusNotFound, librobot.ErrTaskNotFound)
+		return
+	}
+	robot, ok := s.robots[rec.RobotID]
+	if !ok {
+		// The robot was removed while the request was being served
+		delete(s.tasks, taskID)
+		writeError(w, http.StatusNotFound, librobot.ErrTaskNotFound)
+		return
+	}
+	status, err := robot.TaskStatus(taskID)
+	if err != nil {
+		// The robot has forgotten the task after its retention period, so forget it here too
+		delete(s.tasks, taskID)
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newTaskStatusResponse(rec, status))
+}
+
+// newTaskStatusResponse combines the robot's task status with the last state reported for the task.
+// The server mutex must be held.
+func newTaskStatusResponse(rec *taskRecord, status librobot.TaskStatus) taskStatusResponse {
+	resp := taskStatusResponse{
+		ID:               status.ID,
+		RobotID:          rec.RobotID,
+		Commands:         status.Commands,
+		Priority:         int(status.Priority),
+		Status:           string(status.State),
+		State:            rec.State,
+		TotalCommands:    status.TotalCommands,
+		CommandsExecuted: status.CommandsExecuted,
+		QueuedAt:         status.QueuedAt,
+	}
+	if status.FailedCommand != 0 {
+		resp.FailedCommand = string(status.FailedCommand)
+	}
+	if status.Err != nil {
+		resp.Error = status.Err.Error()
+	}
+	if !status.StartedAt.IsZero() {
+		resp.StartedAt = &status.StartedAt
+	}
+	if !status.EndedAt.IsZero() {
+		resp.EndedAt = &status.EndedAt
+	}
+	return resp
+}
+
+// handleCancelTask cancels a queued or running command series.
+func (s *server) handleCancelTask(w http.ResponseWriter, r *http.Request) {
+	robot, ok := s.robot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+	if err := robot.CancelTask(r.PathValue("taskID")); err != nil {
+		if errors.Is(err, librobot.ErrTaskNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListQueue lists the command series waiting in a robot's queue, in the order they will run.
+func (s *server) handleListQueue(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	robotID := r.PathValue("id")
+	robot, ok := s.robots[robotID]
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+	queue := []taskStatusResponse{}
+	for _, status := range robot.ListQueuedTasks() {
+		rec, ok := s.tasks[status.ID]
+		if !ok {
+			// Queued before the server started, for example restored from a journal
+			rec = &taskRecord{ID: status.ID, RobotID: robotID, State: robot.CurrentState()}
+		}
+		queue = append(queue, newTaskStatusResponse(rec, status))
+	}
+	writeJSON(w, http.StatusOK, queue)
+}
+
+// handleReorderQueue moves queued command series to the front of a robot's queue.
+func (s *server) handleReorderQueue(w http.ResponseWriter, r *http.Request) {
+	var req reorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	robot, ok := s.robot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+	if err := robot.ReorderTasks(req.TaskIDs); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleClearQueue cancels every command series waiting in a robot's queue. The running series carries on.
+func (s *server) handleClearQueue(w http.ResponseWriter, r *http.Request) {
+	robot, ok := s.robot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+	resp := clearResponse{Cancelled: robot.ClearQueue()}
+	if resp.Cancelled == nil {
+		resp.Cancelled = []string{}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handlePauseRobot holds a robot in place once its current command is done.
+func (s *server) handlePauseRobot(w http.ResponseWriter, r *http.Request) {
+	robot, ok := s.robot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+	robot.Pause()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleResumeRobot lets a paused robot carry on with its command series.
+func (s *server) handleResumeRobot(w http.ResponseWriter, r *http.Request) {
+	robot, ok := s.robot(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, librobot.ErrRobotNotFound)
+		return
+	}
+	robot.Resume()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePause holds every robot in the warehouse in place, for example during maintenance.
+func (s *server) handlePause(w http.ResponseWriter, r *http.Request) {
+	s.warehouse.Pause()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleResume lets the robots carry on after the warehouse was paused.
+func (s *server) handleResume(w http.ResponseWriter, r *http.Request) {
+	s.warehouse.Resume()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleEmergencyStop halts every robot at once and returns the state of each robot for the incident report.
+// Command series are rejected until the stop is reset.
+func (s *server) handleEmergencyStop(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.warehouse.EmergencyStop())
+}
+
+// handleGetIncident returns the incident report of the current emergency stop.
+func (s *server) handleGetIncident(w http.ResponseWriter, r *http.Request) {
+	incident, ok := s.warehouse.Incident()
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("warehouse is not emergency stopped"))
+		return
+	}
+	writeJSON(w, http.StatusOK, incident)
+}
+
+// handleReset clears an emergency stop, so command series are accepted again.
+func (s *server) handleReset(w http.ResponseWriter, r *http.Request) {
+	s.warehouse.Reset()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAddCrate adds a crate to the warehouse.
+func (s *server) handleAddCrate(w http.ResponseWriter, r *http.Request) {
+	var req crateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if err := s.warehouse.AddCrate(req.X, req.Y); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// handleDelCrate deletes the crate at the given coordinates.
+func (s *server) handleDelCrate(w http.ResponseWriter, r *http.Request) {
+	x, errX := strconv.ParseUint(r.PathValue("x"), 10, 32)
+	y, errY := strconv.ParseUint(r.PathValue("y"), 10, 32)
+	if errX != nil || errY != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid coordinates"))
+		return
+	}
+	if err := s.warehouse.DelCrate(uint(x), uint(y)); err != nil {
+		if errors.Is(err, librobot.ErrCrateNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleListChargers lists the positions of the warehouse's chargers.
+func (s *server) handleListChargers(w http.ResponseWriter, r *http.Request) {
+	chargers := s.warehouse.Chargers()
+	if chargers == nil {
+		chargers = []librobot.Position{}
+	}
+	writeJSON(w, http.StatusOK, chargers)
+}
+
+// handleAddCharger adds a charger to the warehouse.
+func (s *server) handleAddCharger(w http.ResponseWriter, r *http.Request) {
+	var req librobot.Position
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	if err := s.warehouse.AddCharger(req.X, req.Y); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+// handleDelCharger deletes the charger at the given coordinates.
+func (s *server) handleDelCharger(w http.ResponseWriter, r *http.Request) {
+	x, errX := strconv.ParseUint(r.PathValue("x"), 10, 32)
+	y, errY := strconv.ParseUint(r.PathValue("y"), 10, 32)
+	if errX != nil || errY != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid coordinates"))
+		return
+	}
+	if err := s.warehouse.DelCharger(uint(x), uint(y)); err != nil {
+		if errors.Is(err, librobot.ErrChargerNotFound) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// robot looks up a robot by ID.
+func (s *server) robot(id string) (librobot.Robot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	robot, ok := s.robots[id]
+	return robot, ok
+}
+
+// track drains the channels returned by EnqueueTask and records the task's progress.
+// Both channels are closed by the robot once the task completes, fails or is cancelled,
+// at which point the task's webhooks are notified.
+func (s *server) track(rec *taskRecord, posCh chan librobot.RobotState, errCh chan error) {
+	var taskErr error
+	for posCh != nil || errCh != nil {
+		select {
+		case state, ok := <-posCh:
+			if !ok {
+				posCh = nil
+				continue
+			}
+			s.mu.Lock()
+			rec.Status = StatusRunning
+			rec.State = state
+			s.mu.Unlock()
+		case err, ok := <-errCh:
+			if !ok {
+				errCh = nil
+				continue
+			}
+			if err != nil {
+				taskErr = err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	switch {
+	case taskErr == nil:
+		rec.Status = StatusCompleted
+	case errors.Is(taskErr, librobot.ErrTaskCancelled), errors.Is(taskErr, librobot.ErrTaskPreempted):
+		rec.Status = StatusCancelled
+		rec.Error = taskErr.Error()
+	case errors.Is(taskErr, librobot.ErrEmergencyStop):
+		rec.Status = StatusInterrupted
+		rec.Error = taskErr.Error()
+	default:
+		rec.Status = StatusFailed
+		rec.Error = taskErr.Error()
+	}
+	if robot, ok := s.robots[rec.RobotID]; ok {
+		rec.State = robot.CurrentState()
+	}
+
+	// Remove from the robot's pending list
+	queue := s.pending[rec.RobotID]
+	for i, pending := range queue {
+		if pending == rec {
+			s.pending[rec.RobotID] = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+
+	payload := webhookPayload{
+		Event:     "task." + rec.Status,
+		TaskID:    rec.ID,
+		RobotID:   rec.RobotID,
+		Status:    rec.Status,
+		State:     rec.State,
+		Error:     rec.Error,
+		Timestamp: time.Now().UTC(),
+	}
+	callback := rec.Callback
+	s.mu.Unlock()
+
+	s.hooks.notify(payload, callback)
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
+
+// writeError writes an error as a JSON response with the given status code.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// close stops the warehouse's robots and logs any tasks which were abandoned.
+// It then waits, until the context is done, for the webhooks announcing the end of the tasks to be delivered.
+// The warehouse's events stop reaching the stream once it returns.
+func (s *server) close(ctx context.Context) error {
+	defer s.unsubscribe()
+
+	abandoned, err := s.warehouse.Close(ctx)
+	for _, task := range abandoned {
+		log.Printf("Abandoned task %s for robot %s (%d/%d commands executed)",
+			task.Status.ID, task.RobotID, task.Status.CommandsExecuted, task.Status.TotalCommands)
+	}
+	if err != nil {
+		return err
+	}
+	if err := waitContext(ctx, &s.tracking); err != nil {
+		return err
+	}
+	return s.hooks.wait(ctx)
+}
+
+// waitContext waits for the wait group, or until the context is done.
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "address for the RESTful service to listen on")
+	width := flag.Uint("width", librobot.GridSize, "width of the warehouse grid")
+	height := flag.Uint("height", librobot.GridSize, "height of the warehouse grid")
+	secret := flag.String("webhook-secret", os.Getenv("WEBHOOK_SECRET"), "key used to sign webhook payloads (default $WEBHOOK_SECRET)")
+	reservations := flag.Bool("reservations", false, "have robots reserve the cells on their paths in advance")
+	drain := flag.Bool("drain", false, "let robots finish their queued tasks when shutting down")
+	battery := flag.Int("battery", 0, "battery capacity of each robot; 0 for unlimited energy")
+	moveCost := flag.Int("move-cost", 1, "battery charge used by a move")
+	diagonalCost := flag.Int("diagonal-move-cost", 1, "battery charge used by a diagonal move")
+	carryCost := flag.Int("carry-cost", 0, "extra battery charge used by a move while carrying a crate")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long to wait for requests and robots to finish when shutting down")
+	flag.Parse()
+
+	opts := []librobot.WarehouseOption{librobot.WithGridSize(*width, *height)}
+	if *reservations {
+		opts = append(opts, librobot.WithReservations())
+	}
+	if *drain {
+		opts = append(opts, librobot.WithShutdownPolicy(librobot.ShutdownDrain))
+	}
+	if *battery > 0 {
+		opts = append(opts, librobot.WithBattery(librobot.BatteryModel{
+			Capacity:         *battery,
+			MoveCost:         *moveCost,
+			DiagonalMoveCost: *diagonalCost,
+			CarryCost:        *carryCost,
+		}))
+	}
+	s := newServer(librobot.NewCrateWarehouse(opts...), []byte(*secret))
+
+	// Shut down gracefully on SIGTERM or Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	srv := &http.Server{Addr: *addr, Handler: s.routes()}
+	srv.RegisterOnShutdown(s.stream.close)
+	shutdownDone := make(chan struct{}) // Closed once the requests in flight have finished
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		log.Println("Shutting down...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
+	log.Printf("Robot ground control service listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+
+	// ListenAndServe returns as soon as Shutdown starts, so wait for the requests in flight to finish
+	<-shutdownDone
+
+	// No more requests are arriving, so stop the robots
+	closeCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := s.close(closeCtx); err != nil {
+		log.Printf("Error closing warehouse: %v", err)
+	}
+	log.Println("Robot ground control service stopped")
+}
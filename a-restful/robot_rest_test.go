@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"robot_challenge/b-librobot/librobot"
+)
+
+// setupServer creates a server with a fresh crate warehouse and an HTTP test server in front of it.
+func setupServer(t *testing.T) (*server, *httptest.Server) {
+	s := newServer(librobot.NewCrateWarehouse(), []byte("test-secret"))
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// doJSON sends a request with an optional JSON body and decodes the JSON response into out.
+func doJSON(t *testing.T, method, url string, body any, out any) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("Failed to decode response from %s %s: %v", method, url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// waitForStatus polls the task status endpoint until the task reaches the wanted status.
+func waitForStatus(t *testing.T, url string, want string, timeout time.Duration) taskStatusResponse {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	var rec taskStatusResponse
+	for time.Now().Before(deadline) {
+		if code := doJSON(t, http.MethodGet, url, nil, &rec); code != http.StatusOK {
+			t.Fatalf("Expected status 200 from %s, got %d", url, code)
+		}
+		if rec.Status == want {
+			return rec
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("Timeout waiting for task status %q, last status %q", want, rec.Status)
+	return rec
+}
+
+// TestAddRobot tests adding robots and reading them back
+func TestAddRobot(t *testing.T) {
+	_, ts := setupServer(t)
+
+	var robot robotResponse
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1", X: 1, Y: 2}, &robot); code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", code)
+	}
+	if robot.ID != "R1" || robot.State.X != 1 || robot.State.Y != 2 {
+		t.Errorf("Unexpected robot returned: %+v", robot)
+	}
+
+	// Same ID again
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1", X: 3, Y: 3}, nil); code != http.StatusConflict {
+		t.Errorf("Expected status 409 for duplicate robot, got %d", code)
+	}
+	// Occupied position
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R2", X: 1, Y: 2}, nil); code != http.StatusConflict {
+		t.Errorf("Expected status 409 for occupied position, got %d", code)
+	}
+
+	var robots []robotResponse
+	if code := doJSON(t, http.MethodGet, ts.URL+"/robots", nil, &robots); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if len(robots) != 1 {
+		t.Errorf("Expected 1 robot, got %d", len(robots))
+	}
+
+	if code := doJSON(t, http.MethodGet, ts.URL+"/robots/R9", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown robot, got %d", code)
+	}
+}
+
+// TestEnqueueTask tests a command series runs to completion and its status is reported
+func TestEnqueueTask(t *testing.T) {
+	_, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	var rec taskRecord
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N E"}, &rec); code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if rec.ID == "" {
+		t.Fatal("Expected a task ID")
+	}
+
+	final := waitForStatus(t, ts.URL+"/robots/R1/tasks/"+rec.ID, StatusCompleted, 4*librobot.CommandExecutionTime)
+	if final.State.X != 1 || final.State.Y != 1 {
+		t.Errorf("Expected robot at (1,1), got (%d,%d)", final.State.X, final.State.Y)
+	}
+	if final.CommandsExecuted != 2 || final.TotalCommands != 2 || final.StartedAt == nil || final.EndedAt == nil {
+		t.Errorf("Expected progress and timestamps for completed task, got %+v", final)
+	}
+
+	if code := doJSON(t, http.MethodGet, ts.URL+"/robots/R1/tasks/unknown", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown task, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R9/tasks", taskRequest{Commands: "N"}, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown robot, got %d", code)
+	}
+}
+
+// TestEnqueueTask_OutOfBounds tests command series with moves which cannot succeed are rejected before reaching the robot
+func TestEnqueueTask_OutOfBounds(t *testing.T) {
+	s, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N S S"}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for out of bounds series, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N X"}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for unknown command, got %d", code)
+	}
+	s.warehouse.AddObstacle(0, 2)
+	var resp map[string]string
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N N"}, &resp); code != http.StatusUnprocessableEntity ||
+		!strings.Contains(resp["error"], librobot.ErrObstacle.Error()) {
+		t.Errorf("Expected status 422 for a series into an obstacle, got %d %v", code, resp)
+	}
+	if len(s.tasks) != 0 {
+		t.Errorf("Expected no tasks to be sent to the robot, got %d", len(s.tasks))
+	}
+
+	// Queued tasks are checked from where the earlier tasks leave the robot
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "E E E E E E E E E"}, nil); code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "E"}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for series starting from the east edge, got %d", code)
+	}
+
+	// Diagonal robots are checked with their diagonal moves
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R2", X: 5, Y: 5, Diagonal: true}, nil)
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R2/tasks", taskRequest{Commands: string(librobot.MoveNorthEast)}, nil); code != http.StatusAccepted {
+		t.Errorf("Expected status 202 for a diagonal move, got %d", code)
+	}
+}
+
+// TestMoveTo tests a path is planned around other robots and returned with the task
+func TestMoveTo(t *testing.T) {
+	_, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R2", X: 1, Y: 0}, nil)
+
+	var rec taskRecord
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/move", moveRequest{X: 2, Y: 0}, &rec); code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if rec.ID == "" || rec.Commands != "N E E S" {
+		t.Errorf("Expected task with path around R2, got %+v", rec)
+	}
+	final := waitForStatus(t, ts.URL+"/robots/R1/tasks/"+rec.ID, StatusCompleted, 6*librobot.CommandExecutionTime)
+	if final.State.X != 2 || final.State.Y != 0 {
+		t.Errorf("Expected robot at (2,0), got (%d,%d)", final.State.X, final.State.Y)
+	}
+
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/move", moveRequest{X: 1, Y: 0}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for occupied target, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/move", moveRequest{X: 10, Y: 0}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for target outside the warehouse, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R9/move", moveRequest{}, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown robot, got %d", code)
+	}
+}
+
+// TestTaskPriority tests an urgent command series aborting the running series
+func TestTaskPriority(t *testing.T) {
+	_, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	var running, urgent taskRecord
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "NNNNNNNN"}, &running)
+	req := taskRequest{Commands: "E", Priority: 2, Preempt: "abort"}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", req, &urgent); code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", code)
+	}
+	if urgent.Priority != 2 {
+		t.Errorf("Expected priority 2 in the task record, got %d", urgent.Priority)
+	}
+
+	final := waitForStatus(t, ts.URL+"/robots/R1/tasks/"+running.ID, StatusCancelled, 3*librobot.CommandExecutionTime)
+	if final.Error != librobot.ErrTaskPreempted.Error() {
+		t.Errorf("Expected error %q, got %q", librobot.ErrTaskPreempted, final.Error)
+	}
+	final = waitForStatus(t, ts.URL+"/robots/R1/tasks/"+urgent.ID, StatusCompleted, 3*librobot.CommandExecutionTime)
+	if final.Priority != 2 {
+		t.Errorf("Expected priority 2 in the task status, got %d", final.Priority)
+	}
+
+	req.Preempt = "later"
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", req, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown preemption mode, got %d", code)
+	}
+}
+
+// TestQueue tests listing, reordering and clearing a robot's queue
+func TestQueue(t *testing.T) {
+	_, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	var running, a, b, front taskRecord
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "NNNNNNNN"}, &running)
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "E"}, &a)
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "E"}, &b)
+	waitForStatus(t, ts.URL+"/robots/R1/tasks/"+running.ID, StatusRunning, 2*librobot.CommandExecutionTime)
+
+	queueIDs := func() []string {
+		var queue []taskStatusResponse
+		if code := doJSON(t, http.MethodGet, ts.URL+"/robots/R1/queue", nil, &queue); code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", code)
+		}
+		var ids []string
+		for _, status := range queue {
+			ids = append(ids, status.ID)
+		}
+		return ids
+	}
+	if ids := queueIDs(); !slices.Equal(ids, []string{a.ID, b.ID}) {
+		t.Errorf("Expected queue %v, got %v", []string{a.ID, b.ID}, ids)
+	}
+
+	if code := doJSON(t, http.MethodPut, ts.URL+"/robots/R1/queue", reorderRequest{TaskIDs: []string{b.ID}}, nil); code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", code)
+	}
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "S", Front: true}, &front)
+	if ids := queueIDs(); !slices.Equal(ids, []string{front.ID, b.ID, a.ID}) {
+		t.Errorf("Expected queue %v, got %v", []string{front.ID, b.ID, a.ID}, ids)
+	}
+	if code := doJSON(t, http.MethodPut, ts.URL+"/robots/R1/queue", reorderRequest{TaskIDs: []string{running.ID}}, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 reordering the running task, got %d", code)
+	}
+
+	var cleared clearResponse
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/robots/R1/queue", nil, &cleared); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if len(cleared.Cancelled) != 3 || len(queueIDs()) != 0 {
+		t.Errorf("Expected 3 tasks to be cleared, got %v", cleared.Cancelled)
+	}
+	waitForStatus(t, ts.URL+"/robots/R1/tasks/"+a.ID, StatusCancelled, librobot.CommandExecutionTime)
+
+	// A robot with a full queue rejects more series
+	full := httptest.NewServer(newServer(librobot.NewCrateWarehouse(librobot.WithQueueCapacity(1)), []byte("test-secret")).routes())
+	t.Cleanup(full.Close)
+	doJSON(t, http.MethodPost, full.URL+"/robots", robotRequest{ID: "R1"}, nil)
+	doJSON(t, http.MethodPost, full.URL+"/robots/R1/tasks", taskRequest{Commands: "NNN"}, &running)
+	waitForStatus(t, full.URL+"/robots/R1/tasks/"+running.ID, StatusRunning, librobot.CommandExecutionTime)
+	doJSON(t, http.MethodPost, full.URL+"/robots/R1/tasks", taskRequest{Commands: "E"}, nil)
+	if code := doJSON(t, http.MethodPost, full.URL+"/robots/R1/tasks", taskRequest{Commands: "E"}, nil); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 for a full queue, got %d", code)
+	}
+}
+
+// TestValidateTask tests command series are dry-run against the robot and crates without being sent to the robot
+func TestValidateTask(t *testing.T) {
+	s, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+	doJSON(t, http.MethodPost, ts.URL+"/crates", crateRequest{X: 0, Y: 1}, nil)
+
+	var resp validateResponse
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/validate", taskRequest{Commands: "N G E"}, &resp); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if !resp.Valid || len(resp.Path) != 3 || resp.Final != (librobot.RobotState{X: 1, Y: 1, HasCrate: true}) || resp.FailedIndex != -1 {
+		t.Errorf("Expected valid series ending at (1,1) with a crate, got %+v", resp)
+	}
+
+	// No crate to grab at (1,0)
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/validate", taskRequest{Commands: "E G N"}, &resp)
+	if resp.Valid || resp.FailedCommand != "G" || resp.FailedIndex != 1 || resp.Error != librobot.ErrCrateNotFound.Error() {
+		t.Errorf("Expected series to fail grabbing at (1,0), got %+v", resp)
+	}
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/validate", taskRequest{Commands: "S"}, &resp)
+	if resp.Valid || resp.Error != librobot.ErrOutOfBounds.Error() || len(resp.Path) != 0 {
+		t.Errorf("Expected series to leave the warehouse, got %+v", resp)
+	}
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/validate", taskRequest{Commands: "N X"}, &resp)
+	if resp.Valid || resp.Error == "" {
+		t.Errorf("Expected unknown command to be reported, got %+v", resp)
+	}
+
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R9/validate", taskRequest{Commands: "N"}, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown robot, got %d", code)
+	}
+	if len(s.tasks) != 0 {
+		t.Errorf("Expected no tasks to be sent to the robot, got %d", len(s.tasks))
+	}
+}
+
+// TestCancelTask tests cancelling a running command series
+func TestCancelTask(t *testing.T) {
+	_, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	var rec taskRecord
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "NNNNNNNN"}, &rec)
+
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/robots/R1/tasks/"+rec.ID, nil, nil); code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", code)
+	}
+	final := waitForStatus(t, ts.URL+"/robots/R1/tasks/"+rec.ID, StatusCancelled, 3*librobot.CommandExecutionTime)
+	if final.Error == "" {
+		t.Error("Expected cancellation reason to be reported")
+	}
+
+	// Cancelling again fails
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/robots/R1/tasks/"+rec.ID, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 cancelling a finished task, got %d", code)
+	}
+}
+
+// TestPause tests pausing and resuming a robot and the whole warehouse
+func TestPause(t *testing.T) {
+	_, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R2/pause", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 pausing an unknown robot, got %d", code)
+	}
+
+	for _, pause := range []string{"/robots/R1/", "/"} {
+		if code := doJSON(t, http.MethodPost, ts.URL+pause+"pause", nil, nil); code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", code)
+		}
+
+		// A paused robot keeps its series queued
+		var rec taskRecord
+		doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N"}, &rec)
+		time.Sleep(200 * time.Millisecond)
+		var status taskStatusResponse
+		doJSON(t, http.MethodGet, ts.URL+"/robots/R1/tasks/"+rec.ID, nil, &status)
+		if status.Status != StatusQueued {
+			t.Errorf("Expected the series to stay queued while paused via %spause, got %s", pause, status.Status)
+		}
+
+		if code := doJSON(t, http.MethodPost, ts.URL+pause+"resume", nil, nil); code != http.StatusNoContent {
+			t.Fatalf("Expected status 204, got %d", code)
+		}
+		waitForStatus(t, ts.URL+"/robots/R1/tasks/"+rec.ID, StatusCompleted, 3*librobot.CommandExecutionTime)
+	}
+}
+
+// TestEmergencyStop tests stopping every robot, the incident report and resetting the stop
+func TestEmergencyStop(t *testing.T) {
+	_, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	if code := doJSON(t, http.MethodGet, ts.URL+"/estop", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 before a stop, got %d", code)
+	}
+
+	var rec taskRecord
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "NNNNNNNN"}, &rec)
+	waitForStatus(t, ts.URL+"/robots/R1/tasks/"+rec.ID, StatusRunning, 2*librobot.CommandExecutionTime)
+
+	var incident librobot.Incident
+	if code := doJSON(t, http.MethodPost, ts.URL+"/estop", nil, &incident); code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", code)
+	}
+	if len(incident.Robots) != 1 || incident.Robots[0].RobotID != "R1" || incident.Robots[0].TaskID != rec.ID {
+		t.Errorf("Unexpected incident report %+v", incident)
+	}
+	final := waitForStatus(t, ts.URL+"/robots/R1/tasks/"+rec.ID, StatusInterrupted, librobot.CommandExecutionTime)
+	if final.Error == "" {
+		t.Error("Expected the interruption to be reported")
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "E"}, nil); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while stopped, got %d", code)
+	}
+	if code := doJSON(t, http.MethodGet, ts.URL+"/estop", nil, &incident); code != http.StatusOK || len(incident.Robots) != 1 {
+		t.Errorf("Expected the incident report while stopped, got %d", code)
+	}
+
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/estop", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "E"}, nil); code != http.StatusAccepted {
+		t.Errorf("Expected status 202 after reset, got %d", code)
+	}
+}
+
+// TestRemoveRobot tests removing robots, cancelling their tasks
+func TestRemoveRobot(t *testing.T) {
+	_, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	var rec taskRecord
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "NNNNNNNN"}, &rec)
+
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/robots/R1?drain=maybe", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid option, got %d", code)
+	}
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/robots/R1", nil, nil); code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", code)
+	}
+	if code := doJSON(t, http.MethodGet, ts.URL+"/robots/R1", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for removed robot, got %d", code)
+	}
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/robots/R1", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 removing again, got %d", code)
+	}
+	if code := doJSON(t, http.MethodGet, ts.URL+"/robots/R1/tasks/"+rec.ID, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a task of the removed robot, got %d", code)
+	}
+	// The cell is free again
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R2"}, nil); code != http.StatusCreated {
+		t.Errorf("Expected status 201 adding a robot in the removed robot's place, got %d", code)
+	}
+}
+
+// TestClose tests closing the server's warehouse rejects further work
+func TestClose(t *testing.T) {
+	s, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	if err := s.close(context.Background()); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N"}, nil); code != http.StatusConflict {
+		t.Errorf("Expected status 409 after close, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R2", X: 1}, nil); code != http.StatusConflict {
+		t.Errorf("Expected status 409 adding a robot after close, got %d", code)
+	}
+}
+
+// TestCrates tests adding and deleting crates
+func TestCrates(t *testing.T) {
+	_, ts := setupServer(t)
+
+	if code := doJSON(t, http.MethodPost, ts.URL+"/crates", crateRequest{X: 2, Y: 3}, nil); code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/crates", crateRequest{X: 2, Y: 3}, nil); code != http.StatusConflict {
+		t.Errorf("Expected status 409 for existing crate, got %d", code)
+	}
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/crates/2/3", nil, nil); code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", code)
+	}
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/crates/2/3", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing crate, got %d", code)
+	}
+}
+
+// TestChargers tests adding, listing and deleting chargers, and charging robots with batteries
+func TestChargers(t *testing.T) {
+	model := librobot.BatteryModel{Capacity: 10, MoveCost: 3}
+	s := newServer(librobot.NewCrateWarehouse(librobot.WithBattery(model)), []byte("test-secret"))
+	ts := httptest.NewServer(s.routes())
+	t.Cleanup(ts.Close)
+
+	if code := doJSON(t, http.MethodPost, ts.URL+"/chargers", librobot.Position{X: 0, Y: 1}, nil); code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/chargers", librobot.Position{X: 0, Y: 1}, nil); code != http.StatusConflict {
+		t.Errorf("Expected status 409 for existing charger, got %d", code)
+	}
+	var chargers []librobot.Position
+	if code := doJSON(t, http.MethodGet, ts.URL+"/chargers", nil, &chargers); code != http.StatusOK || len(chargers) != 1 {
+		t.Errorf("Expected one charger, got %d %v", code, chargers)
+	}
+
+	// Moves use charge until the robot charges on the charger
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+	var rec taskRecord
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N E W C"}, &rec)
+	waitForStatus(t, ts.URL+"/robots/R1/tasks/"+rec.ID, StatusCompleted, 5*librobot.CommandExecutionTime)
+	var robot robotResponse
+	doJSON(t, http.MethodGet, ts.URL+"/robots/R1", nil, &robot)
+	if robot.State.Battery != model.Capacity {
+		t.Errorf("Expected a full battery after charging, got %+v", robot.State)
+	}
+	// Series the robot has not the charge for are rejected
+	if code := doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "E W E W"}, nil); code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for a series beyond the battery, got %d", code)
+	}
+
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/chargers/0/1", nil, nil); code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", code)
+	}
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/chargers/0/1", nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for missing charger, got %d", code)
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"robot_challenge/b-librobot/librobot"
+)
+
+// Stream event types, as published by the warehouse
+const (
+	EventRobotAdded         = string(librobot.EventRobotAdded)
+	EventRobotRemoved       = string(librobot.EventRobotRemoved)
+	EventRobotMoved         = string(librobot.EventRobotMoved)
+	EventRobotBlocked       = string(librobot.EventRobotBlocked)
+	EventRobotWaiting       = string(librobot.EventRobotWaiting)
+	EventRobotRerouted      = string(librobot.EventRobotRerouted)
+	EventRobotYielded       = string(librobot.EventRobotYielded)
+	EventReservationRevoked = string(librobot.EventReservationRevoked)
+	EventDeadlockDetected   = string(librobot.EventDeadlockDetected)
+	EventRobotPaused        = string(librobot.EventRobotPaused)
+	EventRobotResumed       = string(librobot.EventRobotResumed)
+	EventWarehousePaused    = string(librobot.EventWarehousePaused)
+	EventWarehouseResumed   = string(librobot.EventWarehouseResumed)
+	EventEmergencyStop      = string(librobot.EventEmergencyStop)
+	EventEmergencyReset     = string(librobot.EventEmergencyReset)
+	EventCrateAdded         = string(librobot.EventCrateAdded)
+	EventCrateRemoved       = string(librobot.EventCrateRemoved)
+	EventCrateGrabbed       = string(librobot.EventCrateGrabbed)
+	EventCrateDropped       = string(librobot.EventCrateDropped)
+	EventRobotCharged       = string(librobot.EventRobotCharged)
+	EventObstacleAdded      = string(librobot.EventObstacleAdded)
+	EventObstacleRemoved    = string(librobot.EventObstacleRemoved)
+	EventChargerAdded       = string(librobot.EventChargerAdded)
+	EventChargerRemoved     = string(librobot.EventChargerRemoved)
+	EventTaskQueued         = string(librobot.EventTaskQueued)
+	EventTaskStarted        = string(librobot.EventTaskStarted)
+	EventTaskCompleted      = string(librobot.EventTaskCompleted)
+	EventTaskFailed         = string(librobot.EventTaskFailed)
+	EventTaskCancelled      = string(librobot.EventTaskCancelled)
+	EventTaskPreempted      = string(librobot.EventTaskPreempted)
+	EventTaskInterrupted    = string(librobot.EventTaskInterrupted)
+)
+
+const (
+	// subscriberBufferLen is the number of events buffered per subscriber before they are dropped
+	subscriberBufferLen = 64
+	// websocketGUID is appended to the client key during the WebSocket handshake (RFC 6455)
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+// streamEvent is sent to dashboards subscribed to the warehouse
+type streamEvent struct {
+	Seq       uint64              `json:"seq"`
+	Type      string              `json:"type"`
+	RobotID   string              `json:"robot_id,omitempty"`
+	TaskID    string              `json:"task_id,omitempty"`
+	X         uint                `json:"x"`
+	Y         uint                `json:"y"`
+	State     librobot.RobotState `json:"state"`
+	BlockedBy string              `json:"blocked_by,omitempty"`
+	Robots    []string            `json:"robots,omitempty"`
+	Error     string              `json:"error,omitempty"`
+	Timestamp time.Time           `json:"timestamp"`
+}
+
+// newStreamEvent converts a warehouse event for streaming.
+func newStreamEvent(ev librobot.Event) streamEvent {
+	out := streamEvent{
+		Seq:       ev.Seq,
+		Type:      string(ev.Type),
+		RobotID:   ev.RobotID,
+		TaskID:    ev.TaskID,
+		X:         ev.X,
+		Y:         ev.Y,
+		State:     ev.State,
+		BlockedBy: ev.BlockedBy,
+		Robots:    ev.Robots,
+		Timestamp: ev.Time.UTC(),
+	}
+	if ev.Err != nil {
+		out.Error = ev.Err.Error()
+	}
+	return out
+}
+
+// subscriber receives the events matching its filter. Empty filter fields match everything.
+type subscriber struct {
+	robotID string
+	taskID  string
+	events  chan streamEvent
+}
+
+// matches reports whether the event passes the subscriber's filter.
+func (sub *subscriber) matches(ev streamEvent) bool {
+	return (sub.robotID == "" || sub.robotID == ev.RobotID) && (sub.taskID == "" || sub.taskID == ev.TaskID)
+}
+
+// streamHub fans events out to any number of subscribers
+type streamHub struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	closing     chan struct{} // Closed when the server shuts down, ending every stream
+	closeOnce   sync.Once
+}
+
+// newStreamHub creates a hub with no subscribers.
+func newStreamHub() *streamHub {
+	return &streamHub{subscribers: make(map[*subscriber]struct{}), closing: make(chan struct{})}
+}
+
+// close ends every open stream. http.Server.Shutdown neither cancels the requests of open streams nor sees
+// hijacked WebSocket connections, so it is registered with RegisterOnShutdown.
+func (h *streamHub) close() {
+	h.closeOnce.Do(func() { close(h.closing) })
+}
+
+// subscribe registers a subscriber for events matching robotID and taskID.
+func (h *streamHub) subscribe(robotID, taskID string) *subscriber {
+	sub := &subscriber{robotID: robotID, taskID: taskID, events: make(chan streamEvent, subscriberBufferLen)}
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// unsubscribe removes a subscriber.
+func (h *streamHub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	delete(h.subscribers, sub)
+	h.mu.Unlock()
+}
+
+// forward publishes warehouse events to the hub's subscribers until the events channel is closed.
+func (h *streamHub) forward(events <-chan librobot.Event) {
+	for ev := range events {
+		h.publish(newStreamEvent(ev))
+	}
+}
+
+// publish sends the event to every matching subscriber.
+// It never blocks; a subscriber which is not keeping up misses the event.
+func (h *streamHub) publish(ev streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		if !sub.matches(ev) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			log.Printf("Stream subscriber is not keeping up; dropped %s event for robot %s", ev.Type, ev.RobotID)
+		}
+	}
+}
+
+// handleEventStream streams events to the client using Server-Sent Events.
+// The robot_id and task_id query parameters restrict the stream to one robot or one task.
+func (s *server) handleEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+
+	sub := s.stream.subscribe(r.URL.Query().Get("robot_id"), r.URL.Query().Get("task_id"))
+	defer s.stream.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	// Comment line lets the client know the subscription is live
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	for {
+		select {
+		case ev := <-sub.events:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("Error encoding stream event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.stream.closing:
+			return
+		}
+	}
+}
+
+// handleWebSocket streams events to the client over a WebSocket connection.
+// It accepts the same query parameters as handleEventStream. Events are sent as JSON text frames.
+func (s *server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		!strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade") {
+		writeError(w, http.StatusBadRequest, errors.New("expected websocket upgrade"))
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing Sec-WebSocket-Key"))
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("websocket not supported"))
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		log.Printf("Error hijacking websocket connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	sub := s.stream.subscribe(r.URL.Query().Get("robot_id"), r.URL.Query().Get("task_id"))
+	defer s.stream.unsubscribe(sub)
+
+	accept := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(accept[:]))
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	// Writes come from both the event loop and pong replies
+	var writeMu sync.Mutex
+	write := func(opcode byte, payload []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return writeFrame(conn, opcode, payload)
+	}
+
+	// Read client frames until the client closes the connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			opcode, payload, err := readFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsOpClose:
+				write(wsOpClose, nil)
+				return
+			case wsOpPing:
+				write(wsOpPong, payload)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case ev := <-sub.events:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				log.Printf("Error encoding stream event: %v", err)
+				continue
+			}
+			if err := write(wsOpText, data); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		case <-s.stream.closing:
+			write(wsOpClose, nil)
+			return
+		}
+	}
+}
+
+// WebSocket frame opcodes
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// writeFrame writes a single unmasked, unfragmented WebSocket frame.
+func writeFrame(w io.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	_, err := w.Write(append(header, payload...))
+	return err
+}
+
+// readFrame reads a single WebSocket frame, unmasking the payload if required.
+func readFrame(r *bufio.Reader) (opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	length := uint64(head[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	// Clients only send control frames and small messages
+	if length > 1<<20 {
+		return 0, nil, errors.New("websocket frame too large")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
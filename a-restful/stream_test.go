@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"robot_challenge/b-librobot/librobot"
+)
+
+// readSSE reads Server-Sent Events from the stream until count events have been received.
+func readSSE(t *testing.T, reader *bufio.Reader, count int) []streamEvent {
+	t.Helper()
+	var events []streamEvent
+	for len(events) < count {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error reading event stream after %d events: %v", len(events), err)
+		}
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data: "); ok {
+			var ev streamEvent
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				t.Fatalf("Failed to decode event %q: %v", data, err)
+			}
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+// TestEventStream_SSE tests a robot's task lifecycle, movement and crate events are streamed over SSE
+func TestEventStream_SSE(t *testing.T) {
+	s, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R2", X: 5, Y: 5}, nil)
+	s.warehouse.AddCrate(0, 1)
+
+	resp, err := http.Get(ts.URL + "/events?robot_id=R1")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+	reader := bufio.NewReader(resp.Body)
+	// Wait for the subscription to be live
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, ": connected") {
+		t.Fatalf("Expected connected comment, got %q", line)
+	}
+
+	// Robot R2 is filtered out of the stream
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R2/tasks", taskRequest{Commands: "N"}, nil)
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N G"}, nil)
+
+	events := readSSE(t, reader, 5)
+	expected := []string{EventTaskQueued, EventTaskStarted, EventRobotMoved, EventCrateGrabbed, EventTaskCompleted}
+	for i, ev := range events {
+		if ev.Type != expected[i] {
+			t.Errorf("Event %d: expected %s, got %s", i, expected[i], ev.Type)
+		}
+		if ev.RobotID != "R1" {
+			t.Errorf("Event %d: expected robot R1, got %s", i, ev.RobotID)
+		}
+	}
+	if !events[4].State.HasCrate || events[4].State.Y != 1 {
+		t.Errorf("Expected final state at (0,1) with crate, got %+v", events[4].State)
+	}
+}
+
+// TestEventStream_WebSocket tests events are streamed to a WebSocket client
+func TestEventStream_WebSocket(t *testing.T) {
+	_, ts := setupServer(t)
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	keyBytes := make([]byte, 16)
+	rand.Read(keyBytes)
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/ws", nil)
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("Failed to send handshake: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatalf("Failed to read handshake response: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected status 101, got %d", resp.StatusCode)
+	}
+
+	var rec taskRecord
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "E"}, &rec)
+
+	conn.SetReadDeadline(time.Now().Add(3 * librobot.CommandExecutionTime))
+	var types []string
+	for len(types) < 4 {
+		opcode, payload, err := readFrame(reader)
+		if err != nil {
+			t.Fatalf("Error reading frame after %v: %v", types, err)
+		}
+		if opcode != wsOpText {
+			t.Fatalf("Expected text frame, got opcode %d", opcode)
+		}
+		var ev streamEvent
+		if err := json.Unmarshal(payload, &ev); err != nil {
+			t.Fatalf("Failed to decode event: %v", err)
+		}
+		if ev.TaskID != rec.ID {
+			t.Errorf("Expected task %s, got %s", rec.ID, ev.TaskID)
+		}
+		types = append(types, ev.Type)
+	}
+	expected := []string{EventTaskQueued, EventTaskStarted, EventRobotMoved, EventTaskCompleted}
+	if strings.Join(types, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected events %v, got %v", expected, types)
+	}
+
+	// Close handshake; client frames are masked
+	if _, err := conn.Write([]byte{0x80 | wsOpClose, 0x80, 0, 0, 0, 0}); err != nil {
+		t.Fatalf("Failed to send close frame: %v", err)
+	}
+	if opcode, _, err := readFrame(reader); err != nil || opcode != wsOpClose {
+		t.Errorf("Expected close frame in reply, got opcode %d, err %v", opcode, err)
+	}
+}
+
+// TestEventStream_Shutdown tests open streams end when the server shuts down, so Shutdown does not wait on them
+func TestEventStream_Shutdown(t *testing.T) {
+	s := newServer(librobot.NewCrateWarehouse(), []byte("test-secret"))
+	ts := httptest.NewUnstartedServer(s.routes())
+	ts.Config.RegisterOnShutdown(s.stream.close)
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, ": connected") {
+		t.Fatalf("Expected connected comment, got %q", line)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ts.Config.Shutdown(ctx); err != nil {
+		t.Errorf("Expected shutdown to finish with a stream open, got %v", err)
+	}
+	if _, err := io.ReadAll(reader); err != nil {
+		t.Errorf("Expected the stream to end cleanly, got %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"robot_challenge/b-librobot/librobot"
+
+	"github.com/google/uuid"
+)
+
+// Webhook delivery defaults
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the payload, prefixed with "sha256="
+	SignatureHeader = "X-Robot-Signature"
+	// defaultMaxAttempts is the number of times a payload is sent before giving up
+	defaultMaxAttempts = 5
+	// defaultBackoff is the wait before the first retry; it doubles on each retry
+	defaultBackoff = 500 * time.Millisecond
+)
+
+// webhookPayload is the JSON body posted to callback URLs when a task finishes
+type webhookPayload struct {
+	Event     string              `json:"event"` // task.completed, task.failed, task.cancelled or task.interrupted
+	TaskID    string              `json:"task_id"`
+	RobotID   string              `json:"robot_id"`
+	Status    string              `json:"status"`
+	State     librobot.RobotState `json:"state"` // Final state of the robot
+	Error     string              `json:"error,omitempty"`
+	Timestamp time.Time           `json:"timestamp"`
+}
+
+// webhook is a callback URL registered for every task
+type webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// webhookRequest is the body accepted by POST /webhooks
+type webhookRequest struct {
+	URL string `json:"url"`
+}
+
+// webhookNotifier delivers signed task notifications to callback URLs
+type webhookNotifier struct {
+	client      *http.Client
+	secret      []byte        // Key used to sign payloads; payloads are unsigned if empty
+	maxAttempts int           // Attempts made per URL before giving up
+	backoff     time.Duration // Wait before the first retry, doubled on each retry
+
+	mu     sync.Mutex
+	global map[string]webhook // Webhooks notified for every task, by ID
+	wg     sync.WaitGroup     // Tracks deliveries in flight
+}
+
+// newWebhookNotifier creates a notifier signing payloads with secret.
+func newWebhookNotifier(secret []byte) *webhookNotifier {
+	return &webhookNotifier{
+		client:      &http.Client{Timeout: 10 * time.Second},
+		secret:      secret,
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+		global:      make(map[string]webhook),
+	}
+}
+
+// register adds a webhook notified for every task.
+func (n *webhookNotifier) register(rawURL string) (webhook, error) {
+	if err := validateCallbackURL(rawURL); err != nil {
+		return webhook{}, err
+	}
+	hook := webhook{ID: uuid.New().String(), URL: rawURL}
+
+	n.mu.Lock()
+	n.global[hook.ID] = hook
+	n.mu.Unlock()
+	return hook, nil
+}
+
+// unregister removes a global webhook.
+func (n *webhookNotifier) unregister(id string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.global[id]; !ok {
+		return false
+	}
+	delete(n.global, id)
+	return true
+}
+
+// list returns the registered global webhooks.
+func (n *webhookNotifier) list() []webhook {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	hooks := make([]webhook, 0, len(n.global))
+	for _, hook := range n.global {
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+// notify sends the payload to the task's own callback URL, if any, and to every global webhook.
+// Deliveries happen in the background so the caller is never held up by a slow receiver.
+func (n *webhookNotifier) notify(payload webhookPayload, taskURL string) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding webhook payload for task %s: %v", payload.TaskID, err)
+		return
+	}
+
+	urls := make([]string, 0, 1)
+	if taskURL != "" {
+		urls = append(urls, taskURL)
+	}
+	for _, hook := range n.list() {
+		urls = append(urls, hook.URL)
+	}
+
+	for _, target := range urls {
+		n.wg.Add(1)
+		go func(target string) {
+			defer n.wg.Done()
+			if err := n.deliver(target, body); err != nil {
+				log.Printf("Webhook for task %s to %s abandoned: %v", payload.TaskID, target, err)
+			}
+		}(target)
+	}
+}
+
+// wait blocks until the deliveries in flight have finished, or the context is done.
+func (n *webhookNotifier) wait(ctx context.Context) error {
+	return waitContext(ctx, &n.wg)
+}
+
+// deliver posts body to target, retrying with exponential backoff until a 2xx response is received.
+func (n *webhookNotifier) deliver(target string, body []byte) error {
+	wait := n.backoff
+	var lastErr error
+	for attempt := 1; attempt <= n.maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+
+		req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if len(n.secret) > 0 {
+			req.Header.Set(SignatureHeader, "sha256="+sign(n.secret, body))
+		}
+
+		resp, err := n.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("after %d attempts: %w", n.maxAttempts, lastErr)
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body.
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateCallbackURL checks a callback URL is an absolute http(s) URL.
+func validateCallbackURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid callback url: %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid callback url: must be an absolute http or https url")
+	}
+	return nil
+}
+
+// handleListWebhooks returns the registered global webhooks.
+func (s *server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.hooks.list())
+}
+
+// handleAddWebhook registers a webhook notified whenever any task finishes.
+func (s *server) handleAddWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+		return
+	}
+	hook, err := s.hooks.register(req.URL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+// handleDelWebhook removes a global webhook.
+func (s *server) handleDelWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.hooks.unregister(r.PathValue("hookID")) {
+		writeError(w, http.StatusNotFound, errors.New("webhook not found"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"robot_challenge/b-librobot/librobot"
+)
+
+// webhookReceiver is a local stand-in for ground control which records the payloads it receives.
+// The first failures requests are answered with a 500 to exercise retries.
+type webhookReceiver struct {
+	t        *testing.T
+	mu       sync.Mutex
+	failures int
+	attempts int
+	received chan webhookPayload
+}
+
+// newWebhookReceiver starts a receiver which fails the first failures requests.
+func newWebhookReceiver(t *testing.T, failures int) (*webhookReceiver, *httptest.Server) {
+	recv := &webhookReceiver{t: t, failures: failures, received: make(chan webhookPayload, 10)}
+	ts := httptest.NewServer(recv)
+	t.Cleanup(ts.Close)
+	return recv, ts
+}
+
+// ServeHTTP checks the payload signature and records the payload.
+func (recv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if got, want := r.Header.Get(SignatureHeader), "sha256="+sign([]byte("test-secret"), body); got != want {
+		recv.t.Errorf("Expected signature %q, got %q", want, got)
+	}
+
+	recv.mu.Lock()
+	recv.attempts++
+	fail := recv.attempts <= recv.failures
+	recv.mu.Unlock()
+	if fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var payload webhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		recv.t.Errorf("Failed to decode webhook payload: %v", err)
+	}
+	recv.received <- payload
+	w.WriteHeader(http.StatusOK)
+}
+
+// wait returns the next payload received.
+func (recv *webhookReceiver) wait(timeout time.Duration) webhookPayload {
+	recv.t.Helper()
+	select {
+	case payload := <-recv.received:
+		return payload
+	case <-time.After(timeout):
+		recv.t.Fatal("Timeout waiting for webhook")
+	}
+	return webhookPayload{}
+}
+
+// TestWebhook_TaskCallback tests a per task callback is notified with the final state, after retries
+func TestWebhook_TaskCallback(t *testing.T) {
+	s, ts := setupServer(t)
+	s.hooks.backoff = 10 * time.Millisecond
+	recv, hookServer := newWebhookReceiver(t, 2)
+
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+	var rec taskRecord
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N", CallbackURL: hookServer.URL}, &rec)
+
+	payload := recv.wait(3 * librobot.CommandExecutionTime)
+	if payload.Event != "task.completed" || payload.TaskID != rec.ID || payload.RobotID != "R1" {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+	if payload.State.X != 0 || payload.State.Y != 1 {
+		t.Errorf("Expected final state (0,1), got (%d,%d)", payload.State.X, payload.State.Y)
+	}
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	if recv.attempts != 3 {
+		t.Errorf("Expected 3 delivery attempts, got %d", recv.attempts)
+	}
+}
+
+// TestWebhook_Global tests global webhooks are notified of failed tasks
+func TestWebhook_Global(t *testing.T) {
+	s, ts := setupServer(t)
+	recv, hookServer := newWebhookReceiver(t, 0)
+
+	var hook webhook
+	if code := doJSON(t, http.MethodPost, ts.URL+"/webhooks", webhookRequest{URL: hookServer.URL}, &hook); code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", code)
+	}
+	if code := doJSON(t, http.MethodPost, ts.URL+"/webhooks", webhookRequest{URL: "not a url"}, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid url, got %d", code)
+	}
+
+	// Robot has no crate to drop so the task fails
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "D"}, nil)
+
+	payload := recv.wait(3 * librobot.CommandExecutionTime)
+	if payload.Event != "task.failed" || payload.Error != librobot.ErrRobotNotCrate.Error() {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+
+	if code := doJSON(t, http.MethodDelete, ts.URL+"/webhooks/"+hook.ID, nil, nil); code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", code)
+	}
+	if len(s.hooks.list()) != 0 {
+		t.Errorf("Expected no webhooks after delete, got %d", len(s.hooks.list()))
+	}
+}
+
+// TestWebhook_Close tests closing the server waits for the webhooks of the tasks it cancels
+func TestWebhook_Close(t *testing.T) {
+	s, ts := setupServer(t)
+	recv, hookServer := newWebhookReceiver(t, 0)
+
+	doJSON(t, http.MethodPost, ts.URL+"/robots", robotRequest{ID: "R1"}, nil)
+	doJSON(t, http.MethodPost, ts.URL+"/robots/R1/tasks", taskRequest{Commands: "N N N N", CallbackURL: hookServer.URL}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.close(ctx); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	select {
+	case payload := <-recv.received:
+		if payload.Event != "task.cancelled" {
+			t.Errorf("Expected a task.cancelled payload, got %+v", payload)
+		}
+	default:
+		t.Error("Expected the webhook to be delivered before close returned")
+	}
+}
@@ -186,3 +186,34 @@ func Example_phase3() {
 	// Output:
 	// Robot Phase 3 End State 5 : 8 Crate: false
 }
+
+// Example_fakeClock Shows stepping a robot deterministically with a FakeClock instead of waiting in real time
+func Example_fakeClock() {
+	clock := librobot.NewFakeClock(time.Now())
+	w := librobot.NewWarehouse(librobot.WithClock(clock))
+
+	r, err := librobot.AddRobot(w, 0, 0, "R1")
+	if err != nil {
+		log.Printf("Failed to add robot: %v", err)
+	}
+
+	_, _, errCh := r.EnqueueTask("N E")
+
+	// The robot runs each command, then waits on the clock for CommandExecutionTime
+	clock.BlockUntil(1)
+	fmt.Printf("After 1 command: %v : %v\n", r.CurrentState().X, r.CurrentState().Y)
+	clock.Advance(librobot.CommandExecutionTime)
+
+	clock.BlockUntil(1)
+	fmt.Printf("After 2 commands: %v : %v\n", r.CurrentState().X, r.CurrentState().Y)
+	clock.Advance(librobot.CommandExecutionTime)
+
+	// Error channel is closed once the task completes
+	for err := range errCh {
+		log.Printf("Task failed: %v", err)
+	}
+
+	// Output:
+	// After 1 command: 0 : 1
+	// After 2 commands: 1 : 1
+}
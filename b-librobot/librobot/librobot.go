@@ -1,16 +1,19 @@
 package librobot
 
 import (
+	"context"
 	"time"
 )
 
 // Constants used for simulation
 const (
-	// GridSize defines the dimension of the square warehouse grid (for example; 10x10).
-	// Coordinates range from 0 to GridSize.
+	// GridSize defines the default dimension of the square warehouse grid (for example; 10x10).
+	// Coordinates range from 0 to GridSize-1. Use WithGridSize to create warehouses of other sizes.
 	GridSize = 10
-	// CommandExecutionTime defines the real time taken to execute one command.
+	// CommandExecutionTime defines the time taken to execute one command, as measured by the warehouse Clock.
 	CommandExecutionTime = 1 * time.Second
+	// DefaultTaskRetention defines how long finished tasks are kept for TaskStatus.
+	DefaultTaskRetention = 10 * time.Minute
 )
 
 // Define constants for the movement runes for better readability.
@@ -24,6 +27,57 @@ const (
 // Warehouse provides an abstraction of a simulated warehouse containing robots.
 type Warehouse interface {
 	Robots() []Robot
+
+	// Size returns the width and height of the warehouse grid.
+	Size() (width, height uint)
+
+	// AddObstacle marks a cell as impassable to robots and crates.
+	AddObstacle(x uint, y uint) error
+
+	// DelObstacle clears an obstacle cell.
+	DelObstacle(x uint, y uint) error
+
+	// AddCharger marks a cell as a charger, where robots can recharge with the 'C' command.
+	AddCharger(x uint, y uint) error
+
+	// DelCharger removes a charger.
+	DelCharger(x uint, y uint) error
+
+	// Chargers returns the positions of the warehouse's chargers.
+	Chargers() []Position
+
+	// Battery returns the battery model of the warehouse's robots, if they have batteries.
+	Battery() (BatteryModel, bool)
+
+	// Locations returns the named cells of the warehouse, such as those given by a Layout.
+	Locations() map[string]Position
+
+	// Snapshot returns the state of the warehouse, its robots and their pending tasks as JSON, for Restore.
+	Snapshot() ([]byte, error)
+
+	// Close stops accepting robots and tasks, cancels or drains the pending tasks and waits for the robots to stop.
+	// It returns the tasks which were cancelled.
+	Close(ctx context.Context) ([]AbandonedTask, error)
+
+	// Pause holds every robot in place once its current command is done, for example for a maintenance window.
+	Pause()
+
+	// Resume lets the robots carry on after the warehouse was paused.
+	Resume()
+
+	// EmergencyStop halts every robot at once, interrupting running tasks and cancelling queued ones, and rejects
+	// new tasks until Reset is called. It returns the state of each robot at the moment of the stop.
+	EmergencyStop() Incident
+
+	// Reset clears an emergency stop, so tasks are accepted again.
+	Reset()
+
+	// Incident returns the report of the warehouse's emergency stop, if it is stopped.
+	Incident() (Incident, bool)
+
+	// Subscribe returns a channel of warehouse events of the given types, or of every type if none are given,
+	// and a function which ends the subscription.
+	Subscribe(types ...EventType) (events <-chan Event, cancel func())
 }
 
 // CrateWarehouse provides an abstraction of a simulated warehouse containing both robots and crates.
@@ -36,16 +90,90 @@ type CrateWarehouse interface {
 
 // Robot provides an abstraction of a warehouse robot which accepts tasks in the form of strings of commands.
 type Robot interface {
-	EnqueueTask(commands string) (taskID string, position chan RobotState, err chan error)
+	// EnqueueTask adds a task to the robot's queue, ahead of queued tasks of lower priority.
+	EnqueueTask(commands string, opts ...TaskOption) (taskID string, position chan RobotState, err chan error)
+
+	// EnqueueTaskContext adds a task as for EnqueueTask, and cancels it if the context is done before it finishes.
+	EnqueueTaskContext(ctx context.Context, commands string, opts ...TaskOption) (taskID string, position chan RobotState, err chan error)
+
+	// Wait blocks until the task has finished, or the context is done, and returns the task's result.
+	Wait(ctx context.Context, taskID string) (TaskResult, error)
 
 	CancelTask(taskID string) error
 
+	// ListQueuedTasks returns the status of the tasks waiting in the robot's queue, in the order they will run.
+	ListQueuedTasks() []TaskStatus
+
+	// ReorderTasks moves the given queued tasks to the front of the queue, in the given order.
+	ReorderTasks(taskIDs []string) error
+
+	// ClearQueue cancels every task waiting in the robot's queue, and returns their IDs.
+	ClearQueue() []string
+
 	CurrentState() RobotState
+
+	// TaskStatus reports the progress of a queued, running or recently finished task.
+	TaskStatus(taskID string) (TaskStatus, error)
+
+	// Simulate predicts the outcome of a task from where the robot will be once its queued tasks are done,
+	// without queueing it.
+	Simulate(commands string) (Simulation, error)
+
+	// MoveTo plans a shortest path to the given position and enqueues it as a task.
+	// It also returns the generated command string.
+	MoveTo(x, y uint, opts ...TaskOption) (taskID string, commands string, position chan RobotState, err chan error)
+
+	// SetCollisionPolicy sets how the robot responds when another robot blocks its way,
+	// overriding the warehouse's policy.
+	SetCollisionPolicy(p CollisionPolicy)
+
+	// SetPriority sets the robot's priority for resolving conflicting cell reservations; higher priorities win.
+	SetPriority(priority int)
+
+	// Pause holds the robot in place once its current command is done, keeping its tasks.
+	Pause()
+
+	// Resume lets a paused robot carry on with its tasks.
+	Resume()
 }
 
 // RobotState provides an abstraction of the state of a warehouse robot.
 type RobotState struct {
-	X        uint // X coordinate of the robot (0-GridSize)
-	Y        uint // Y coordinate of the robot (0-GridSize)
+	X        uint // X coordinate of the robot (0 to width-1)
+	Y        uint // Y coordinate of the robot (0 to height-1)
 	HasCrate bool // Whether the robot is currently carrying a crate
+	Battery  int  // Charge left in the robot's battery; zero unless the warehouse has a battery model
+}
+
+// TaskState describes where a task is in its lifecycle.
+type TaskState string
+
+// Task lifecycle states
+const (
+	TaskQueued      TaskState = "queued"      // Waiting in the robot's queue
+	TaskRunning     TaskState = "running"     // Currently being executed
+	TaskCompleted   TaskState = "completed"   // Every command was executed
+	TaskFailed      TaskState = "failed"      // Aborted by a command error
+	TaskCancelled   TaskState = "cancelled"   // Cancelled while queued or running
+	TaskInterrupted TaskState = "interrupted" // Stopped while running by Warehouse.EmergencyStop
+)
+
+// Finished reports whether the task has reached a terminal state.
+func (s TaskState) Finished() bool {
+	return s == TaskCompleted || s == TaskFailed || s == TaskCancelled || s == TaskInterrupted
+}
+
+// TaskStatus provides a snapshot of the progress of a task.
+type TaskStatus struct {
+	ID               string
+	State            TaskState
+	Commands         string       // Commands as given to EnqueueTask
+	Priority         TaskPriority // Priority given with WithTaskPriority
+	TotalCommands    int          // Number of commands the robot will execute; diagonal robots combine pairs of moves
+	CommandsExecuted int          // Number of commands executed successfully
+	FailedCommand    rune         // Command which caused the task to fail, or 0
+	Err              error        // Error which aborted the task, if failed, cancelled or interrupted
+	QueuedAt         time.Time    // Time the task was enqueued
+	StartedAt        time.Time    // Time the robot started the task; zero while queued
+	EndedAt          time.Time    // Time the task finished; zero until finished
 }
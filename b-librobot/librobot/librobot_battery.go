@@ -0,0 +1,125 @@
+package librobot
+
+import (
+	"log"
+	"slices"
+)
+
+// Battery model, charger cells and charging
+
+// BatteryModel sets the capacity of each robot's battery and the charge each move uses.
+// Charge is counted in whole units.
+type BatteryModel struct {
+	Capacity         int `json:"capacity"`           // Charge of a full battery; robots are added fully charged
+	MoveCost         int `json:"move_cost"`          // Charge used by a move north, south, east or west
+	DiagonalMoveCost int `json:"diagonal_move_cost"` // Charge used by a diagonal move
+	CarryCost        int `json:"carry_cost"`         // Extra charge used by a move while carrying a crate
+}
+
+// WithBattery gives every robot in the warehouse a battery. Each move uses charge, and a robot without enough charge
+// for its next move stays where it is and fails its task with ErrBatteryDepleted. The charge command 'C' fills the
+// battery of a robot standing on a charger cell. Without this option robots have unlimited energy, and their
+// RobotState.Battery is zero. Models with a Capacity below one are ignored.
+func WithBattery(m BatteryModel) WarehouseOption {
+	return func(w *warehouseImpl) {
+		if m.Capacity > 0 {
+			w.battery = &m
+		}
+	}
+}
+
+// moveCost returns the charge used by a move command. A nil model uses no charge.
+func (m *BatteryModel) moveCost(cmd rune, carrying bool) int {
+	if m == nil {
+		return 0
+	}
+	cost := m.MoveCost
+	if slices.Contains([]rune{MoveNorthEast, MoveNorthWest, MoveSouthEast, MoveSouthWest}, cmd) {
+		cost = m.DiagonalMoveCost
+	}
+	if carrying {
+		cost += m.CarryCost
+	}
+	return cost
+}
+
+// capacity returns the charge of a full battery, or zero if robots have unlimited energy.
+func (m *BatteryModel) capacity() int {
+	if m == nil {
+		return 0
+	}
+	return m.Capacity
+}
+
+// Battery returns the warehouse's battery model, if robots have batteries.
+func (w *warehouseImpl) Battery() (BatteryModel, bool) {
+	if w.battery == nil {
+		return BatteryModel{}, false
+	}
+	return *w.battery, true
+}
+
+// AddCharger marks the cell at x y as a charger, where robots can recharge with the 'C' command.
+// Robots and crates may stand on a charger. Chargers cannot be placed on obstacles.
+func (w *warehouseImpl) AddCharger(x uint, y uint) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.inBounds(x, y) {
+		return ErrOutOfBounds
+	}
+	if w.obstaclesyx[y][x] {
+		return ErrObstacle
+	}
+	if w.chargersyx[y][x] {
+		return ErrChargerExists
+	}
+	w.chargersyx[y][x] = true
+	log.Printf("Charger added at (%d, %d).", x, y)
+	w.publish(Event{Type: EventChargerAdded, X: x, Y: y})
+	w.record(journalEntry{Op: journalChargerAdd, X: x, Y: y})
+	return nil
+}
+
+// DelCharger removes the charger at x y.
+func (w *warehouseImpl) DelCharger(x uint, y uint) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.inBounds(x, y) {
+		return ErrOutOfBounds
+	}
+	if !w.chargersyx[y][x] {
+		return ErrChargerNotFound
+	}
+	w.chargersyx[y][x] = false
+	log.Printf("Charger removed from (%d, %d).", x, y)
+	w.publish(Event{Type: EventChargerRemoved, X: x, Y: y})
+	w.record(journalEntry{Op: journalChargerDel, X: x, Y: y})
+	return nil
+}
+
+// Chargers returns the positions of the warehouse's chargers, ordered by row and then column.
+func (w *warehouseImpl) Chargers() []Position {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var chargers []Position
+	for y := uint(0); y < w.height; y++ {
+		for x := uint(0); x < w.width; x++ {
+			if w.chargersyx[y][x] {
+				chargers = append(chargers, Position{X: x, Y: y})
+			}
+		}
+	}
+	return chargers
+}
+
+// charge fills the robot's battery, if it stands on a charger. The warehouse lock and the robot's mutex must be held.
+func (r *robotImpl) charge() error {
+	if !r.warehouse.chargersyx[r.state.Y][r.state.X] {
+		return ErrNotOnCharger
+	}
+	r.state.Battery = r.warehouse.battery.capacity()
+	return nil
+}
@@ -0,0 +1,164 @@
+package librobot
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the simulation time used by robots to pace their commands.
+// The default clock runs in real time; a FakeClock lets tests step the simulation deterministically.
+type Clock interface {
+	// Now returns the current simulation time.
+	Now() time.Time
+	// After waits for the duration to elapse and then sends the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+	// Sleep pauses the calling goroutine for the duration.
+	Sleep(d time.Duration)
+	// NewTimer returns a Timer which sends the current time on its channel once the duration has elapsed.
+	// Use it rather than After for a wait which may be abandoned, so the wait can be stopped.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single wait on a Clock which can be stopped before it fires.
+type Timer interface {
+	// C returns the channel on which the time is sent when the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It reports whether the timer was stopped before it fired.
+	Stop() bool
+}
+
+// realClock implements Clock using the time package
+type realClock struct{}
+
+// NewRealClock returns a Clock which runs in real time.
+func NewRealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+
+// realTimer implements Timer using the time package
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.timer.C }
+func (t realTimer) Stop() bool          { return t.timer.Stop() }
+
+// FakeClock implements Clock with time that only moves when Advance is called.
+// Robots waiting on the clock are released as soon as the clock is advanced past their deadline,
+// so multi-robot scenarios can be stepped deterministically and instantly.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	changed chan struct{} // Closed and replaced whenever a waiter is added; used by BlockUntil
+}
+
+// fakeWaiter is a goroutine waiting for the fake clock to reach a deadline
+type fakeWaiter struct {
+	clock *FakeClock
+	until time.Time
+	ch    chan time.Time
+}
+
+// NewFakeClock creates a FakeClock starting at the given time.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start, changed: make(chan struct{})}
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel which receives the fake time once the clock has been advanced by at least d.
+// The wait counts towards Waiters until it fires; use NewTimer for a wait which may be abandoned.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer returns a Timer which fires once the clock has been advanced by at least d.
+// A stopped timer no longer counts towards Waiters.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &fakeWaiter{clock: c, until: c.now.Add(d), ch: make(chan time.Time, 1)} // Buffered so Advance never blocks
+	if d <= 0 {
+		w.ch <- c.now
+		return w
+	}
+	c.waiters = append(c.waiters, w)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return w
+}
+
+// C returns the channel on which the fake time is sent when the waiter is released.
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+// Stop removes the waiter from the clock, if it has not been released yet.
+func (w *fakeWaiter) Stop() bool {
+	c := w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, waiter := range c.waiters {
+		if waiter == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Sleep blocks until the clock has been advanced by at least d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance moves the clock forward and releases every waiter whose deadline has been reached.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.until.After(c.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = remaining
+}
+
+// Waiters returns the number of goroutines currently waiting on the clock.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil blocks until at least n goroutines are waiting on the clock.
+// Use it before Advance to be sure every robot has reached the end of its current command.
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		if len(c.waiters) >= n {
+			c.mu.Unlock()
+			return
+		}
+		changed := c.changed
+		c.mu.Unlock()
+		<-changed
+	}
+}
@@ -0,0 +1,139 @@
+package librobot
+
+// This file tests the simulation clock and stepping robots with a FakeClock
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestClock returns a FakeClock starting at a fixed time.
+func newTestClock() *FakeClock {
+	return NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+}
+
+// TestFakeClock_After checks waiters are only released once the clock passes their deadline
+func TestFakeClock_After(t *testing.T) {
+	clock := newTestClock()
+	start := clock.Now()
+
+	ch := clock.After(2 * time.Second)
+	if clock.Waiters() != 1 {
+		t.Fatalf("Expected 1 waiter, got %d", clock.Waiters())
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case <-ch:
+		t.Fatal("Waiter released before its deadline")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case now := <-ch:
+		if !now.Equal(start.Add(2 * time.Second)) {
+			t.Errorf("Expected release at %v, got %v", start.Add(2*time.Second), now)
+		}
+	default:
+		t.Fatal("Waiter not released at its deadline")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("Expected no waiters, got %d", clock.Waiters())
+	}
+
+	// Zero duration fires immediately
+	select {
+	case <-clock.After(0):
+	default:
+		t.Error("After(0) did not fire immediately")
+	}
+}
+
+// TestFakeClock_TimerStop checks a stopped timer no longer counts as a waiter
+func TestFakeClock_TimerStop(t *testing.T) {
+	clock := newTestClock()
+	timer := clock.NewTimer(time.Second)
+	if clock.Waiters() != 1 {
+		t.Fatalf("Expected 1 waiter, got %d", clock.Waiters())
+	}
+	if !timer.Stop() {
+		t.Error("Expected Stop to report the timer was pending")
+	}
+	if clock.Waiters() != 0 {
+		t.Errorf("Expected no waiters after Stop, got %d", clock.Waiters())
+	}
+	if timer.Stop() {
+		t.Error("Expected a second Stop to report nothing pending")
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case <-timer.C():
+		t.Error("Stopped timer fired")
+	default:
+	}
+}
+
+// TestFakeClock_BlockUntil checks BlockUntil returns once a goroutine sleeps on the clock
+func TestFakeClock_BlockUntil(t *testing.T) {
+	clock := newTestClock()
+	done := make(chan struct{})
+	go func() {
+		clock.Sleep(time.Second)
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Sleep was not released by Advance")
+	}
+}
+
+// TestFakeClock_MultiRobotStepping steps two robots one command at a time without waiting in real time
+func TestFakeClock_MultiRobotStepping(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock))
+	r1, _ := AddRobot(w, 0, 0, "R1")
+	r2, _ := AddRobot(w, 2, 0, "R2")
+
+	_, _, errCh1 := r1.EnqueueTask("N N N")
+	_, _, errCh2 := r2.EnqueueTask("E E")
+
+	expected := []struct{ r1, r2 RobotState }{
+		{RobotState{X: 0, Y: 1}, RobotState{X: 3, Y: 0}},
+		{RobotState{X: 0, Y: 2}, RobotState{X: 4, Y: 0}},
+		{RobotState{X: 0, Y: 3}, RobotState{X: 4, Y: 0}},
+	}
+	waiting := 2
+	for step, want := range expected {
+		// Each robot runs a command and then waits on the clock for the command period
+		clock.BlockUntil(waiting)
+		if got := r1.CurrentState(); got != want.r1 {
+			t.Errorf("Step %d: R1 expected %+v, got %+v", step, want.r1, got)
+		}
+		if got := r2.CurrentState(); got != want.r2 {
+			t.Errorf("Step %d: R2 expected %+v, got %+v", step, want.r2, got)
+		}
+		if step == 1 {
+			// R2 finishes its task once the clock moves on
+			waiting = 1
+		}
+		clock.Advance(CommandExecutionTime)
+	}
+
+	for i, errCh := range []chan error{errCh1, errCh2} {
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Errorf("Robot %d task failed: %v", i+1, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Robot %d task did not complete", i+1)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package librobot
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+)
+
+// Graceful shutdown of a warehouse and its robots
+
+// ShutdownPolicy decides what happens to pending tasks when a warehouse is closed.
+type ShutdownPolicy string
+
+// Shutdown policies
+const (
+	ShutdownCancel ShutdownPolicy = "cancel" // Cancel pending tasks; running tasks stop at once
+	ShutdownDrain  ShutdownPolicy = "drain"  // Let robots finish their pending tasks, until the context given to Close is done
+)
+
+// WithShutdownPolicy sets what Close does with the robots' pending tasks. The default is ShutdownCancel.
+func WithShutdownPolicy(p ShutdownPolicy) WarehouseOption {
+	return func(w *warehouseImpl) {
+		w.shutdown = p
+	}
+}
+
+// AbandonedTask is a task which was cancelled because its warehouse was closed.
+type AbandonedTask struct {
+	RobotID string
+	Status  TaskStatus // Status when Close returned; a running task may not have stopped yet if the context expired
+}
+
+// Close stops the warehouse. No more robots or tasks are accepted; AddRobot and EnqueueTask return ErrWarehouseClosed.
+// Pending tasks are cancelled or drained according to the shutdown policy, and Close waits for every robot's worker
+// to stop. If the context is done first, the remaining tasks are cancelled and the context's error is returned
+// without waiting further. The tasks cancelled by Close are returned, in robot ID order.
+//
+// Abandoned tasks are not recorded as finished in the journal, so they are queued again when it is replayed.
+// The journal is closed. Closing a warehouse again returns ErrWarehouseClosed.
+func (w *warehouseImpl) Close(ctx context.Context) ([]AbandonedTask, error) {
+	w.mu.Lock()
+	if w.closed.Load() {
+		w.mu.Unlock()
+		return nil, ErrWarehouseClosed
+	}
+	w.closed.Store(true)
+	robots := make([]*robotImpl, 0, len(w.robots))
+	for _, r := range w.robots {
+		robots = append(robots, r)
+	}
+	w.mu.Unlock()
+	slices.SortFunc(robots, func(a, b *robotImpl) int { return strings.Compare(a.id, b.id) })
+	log.Printf("Closing warehouse with %d robots (%s).", len(robots), w.shutdown)
+
+	workers := make([]chan struct{}, 0, len(robots))
+	for _, r := range robots {
+		workers = append(workers, r.stop())
+	}
+
+	abandoned := make(map[*robotImpl][]string)
+	abandonAll := func() {
+		for _, r := range robots {
+			abandoned[r] = append(abandoned[r], r.abandonTasks()...)
+		}
+	}
+	if w.shutdown != ShutdownDrain {
+		abandonAll()
+	}
+
+	var err error
+	for _, done := range workers {
+		select {
+		case <-done:
+			continue
+		case <-ctx.Done():
+			err = ctx.Err()
+			log.Printf("Warehouse not closed in time: %v; abandoning remaining tasks.", err)
+			abandonAll()
+		}
+		break
+	}
+	w.closeJournal()
+
+	var tasks []AbandonedTask
+	for _, r := range robots {
+		for _, taskID := range abandoned[r] {
+			if status, statusErr := r.TaskStatus(taskID); statusErr == nil {
+				tasks = append(tasks, AbandonedTask{RobotID: r.id, Status: status})
+			}
+		}
+	}
+	log.Printf("Warehouse closed; %d tasks abandoned.", len(tasks))
+	return tasks, err
+}
+
+// discard closes a warehouse which could not be set up, stopping the workers of the robots already added to it.
+func (w *warehouseImpl) discard() {
+	w.Close(context.Background())
+}
+
+// stop tells the robot's worker to stop once its queue is empty, and returns a channel closed when it has stopped.
+// A robot being removed is stopped by RemoveRobot.
+func (r *robotImpl) stop() chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.removing {
+		r.removing = true
+		close(r.stopWorker)
+	}
+	return r.workerDone
+}
+
+// abandonTasks cancels the robot's pending tasks because the warehouse is closing, and returns their IDs.
+func (r *robotImpl) abandonTasks() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var taskIDs []string
+	for _, task := range slices.Clone(r.pending) {
+		if _, ok := r.cancelChannels[task.id]; !ok {
+			continue // Already cancelled
+		}
+		task.abandoned = true
+		r.cancelTask(task.id)
+		taskIDs = append(taskIDs, task.id)
+	}
+	return taskIDs
+}
+
+// closeJournal closes the warehouse's journal, if it has one. Later changes are not recorded.
+func (w *warehouseImpl) closeJournal() {
+	if w.journal == nil {
+		return
+	}
+	w.journal.mu.Lock()
+	defer w.journal.mu.Unlock()
+	if w.journal.file != nil {
+		if err := w.journal.file.Close(); err != nil {
+			log.Printf("Journal: %v", err)
+		}
+		w.journal.file = nil
+	}
+}
@@ -0,0 +1,208 @@
+package librobot
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// Collision policies decide what a robot does when the cell it is moving to is occupied by another robot
+
+// CollisionRetryInterval is the default time between attempts to enter an occupied cell,
+// for the CollisionWait and CollisionRetry policies.
+const CollisionRetryInterval = CommandExecutionTime / 4
+
+// CollisionAction identifies how a robot responds to a blocked move.
+type CollisionAction string
+
+// Collision actions
+const (
+	CollisionAbort   CollisionAction = "abort"   // Abort the task with ErrPositionOccupied
+	CollisionWait    CollisionAction = "wait"    // Wait up to a timeout for the cell to clear
+	CollisionRetry   CollisionAction = "retry"   // Try the move again a number of times
+	CollisionReroute CollisionAction = "reroute" // Plan a path around the blocking robot
+)
+
+// CollisionPolicy configures how a robot responds when another robot is in the cell it is moving to.
+// If the policy gives up, the task is aborted with ErrPositionOccupied as before.
+type CollisionPolicy struct {
+	Action   CollisionAction
+	Timeout  time.Duration // CollisionWait: how long to wait for the cell to clear
+	Retries  int           // CollisionRetry: further attempts at the move; CollisionReroute: replans allowed per task
+	Interval time.Duration // CollisionWait, CollisionRetry: time between attempts; zero for CollisionRetryInterval
+}
+
+// AbortOnCollision returns the default policy, which aborts the task.
+func AbortOnCollision() CollisionPolicy {
+	return CollisionPolicy{Action: CollisionAbort}
+}
+
+// WaitOnCollision returns a policy which waits up to timeout for the cell to clear, checking every CollisionRetryInterval.
+func WaitOnCollision(timeout time.Duration) CollisionPolicy {
+	return CollisionPolicy{Action: CollisionWait, Timeout: timeout}
+}
+
+// RetryOnCollision returns a policy which tries the move up to retries more times, CollisionRetryInterval apart.
+func RetryOnCollision(retries int) CollisionPolicy {
+	return CollisionPolicy{Action: CollisionRetry, Retries: retries}
+}
+
+// RerouteOnCollision returns a policy which plans a path around the blocking robot, up to maxReroutes times per task.
+// The detour ends where the blocked run of moves would have taken the robot, so crate commands still happen in place.
+func RerouteOnCollision(maxReroutes int) CollisionPolicy {
+	return CollisionPolicy{Action: CollisionReroute, Retries: maxReroutes}
+}
+
+// WithCollisionPolicy sets the collision policy of the warehouse's robots. The default is AbortOnCollision.
+// Robot.SetCollisionPolicy overrides it for a single robot.
+func WithCollisionPolicy(p CollisionPolicy) WarehouseOption {
+	return func(w *warehouseImpl) {
+		w.collisionPolicy = p
+	}
+}
+
+// errRerouted is returned by handleCollision when the task's commands have been replaced by a detour,
+// which starts at the blocked command's index
+var errRerouted = errors.New("task rerouted")
+
+// errKeepWaiting is returned by resolveDeadlock when a robot cannot back off, but may carry on waiting
+var errKeepWaiting = errors.New("keep waiting")
+
+// SetCollisionPolicy sets how the robot responds to blocked moves, overriding the warehouse's policy.
+// It applies from the robot's next blocked move.
+func (r *robotImpl) SetCollisionPolicy(p CollisionPolicy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collisionPolicy = &p
+}
+
+// currentCollisionPolicy returns the robot's policy, or the warehouse's if it has none.
+func (r *robotImpl) currentCollisionPolicy() CollisionPolicy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.collisionPolicy != nil {
+		return *r.collisionPolicy
+	}
+	return r.warehouse.collisionPolicy
+}
+
+// handleCollision applies the robot's collision policy after task.cmds[i] was blocked by another robot.
+// It returns nil once the command has been executed, errRerouted if the command was replaced by a detour,
+// ErrTaskCancelled if the task was cancelled while waiting, or the error which aborts the task.
+// Waiting robots are checked for deadlocks, which are resolved by the warehouse's DeadlockStrategy.
+func (r *robotImpl) handleCollision(task *robotTask, i int) error {
+	policy := r.currentCollisionPolicy()
+	cmd := task.cmds[i]
+
+	switch policy.Action {
+	case CollisionWait, CollisionRetry:
+		interval := policy.Interval
+		if interval <= 0 {
+			interval = CollisionRetryInterval
+		}
+		deadline := r.warehouse.clock.Now().Add(policy.Timeout)
+		defer r.endWait()
+		for attempt := 1; ; attempt++ {
+			wait := interval
+			if policy.Action == CollisionWait {
+				remaining := deadline.Sub(r.warehouse.clock.Now())
+				if remaining <= 0 {
+					return ErrPositionOccupied
+				}
+				wait = min(wait, remaining)
+			} else if attempt > policy.Retries {
+				return ErrPositionOccupied
+			}
+
+			log.Printf("Robot %s: Waiting to retry blocked command '%c' (attempt %d)", r.id, cmd, attempt)
+			r.detectDeadlock(r.publishBlockedMove(EventRobotWaiting, task.id, cmd))
+			timer := r.warehouse.clock.NewTimer(wait)
+			select {
+			case <-timer.C():
+			case <-task.cancelCh:
+				timer.Stop()
+				return ErrTaskCancelled
+			case strategy := <-r.deadlock:
+				timer.Stop()
+				if err := r.resolveDeadlock(task, i, strategy); err != errKeepWaiting {
+					return err
+				}
+			}
+
+			err := r.executeTaskCommand(task, i)
+			if !errors.Is(err, ErrPositionOccupied) {
+				return err
+			}
+		}
+
+	case CollisionReroute:
+		if task.reroutes >= max(policy.Retries, 1) {
+			return ErrPositionOccupied
+		}
+		state := r.CurrentState()
+		return r.reroute(task, i, state.X, state.Y)
+	}
+	return ErrPositionOccupied
+}
+
+// reroute replaces the run of moves containing the blocked command task.cmds[i], which starts at (fromX, fromY),
+// with a path from the robot's position around other robots to where the run would have taken the robot.
+func (r *robotImpl) reroute(task *robotTask, i int, fromX, fromY uint) error {
+	r.warehouse.mu.RLock()
+	defer r.warehouse.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Find the end of the run of moves
+	x, y := fromX, fromY
+	end := i
+	for ; end < len(task.cmds) && isMove(task.cmds[end]); end++ {
+		x, y = moveTarget(x, y, task.cmds[end])
+	}
+	if !r.warehouse.inBounds(x, y) {
+		return ErrOutOfBounds
+	}
+
+	path, err := planPath(r.state.X, r.state.Y, x, y, r.warehouse.width, r.warehouse.height, r.isDiagonal, r.blockedCell)
+	if err != nil {
+		return ErrPositionOccupied
+	}
+
+	cmds := make([]rune, 0, len(task.cmds)-(end-i)+len(path))
+	cmds = append(cmds, task.cmds[:i]...)
+	cmds = append(cmds, path...)
+	cmds = append(cmds, task.cmds[end:]...)
+	task.cmds = cmds
+	task.reroutes++
+	r.warehouse.record(journalEntry{Op: journalReroute, Robot: r.id, Task: task.id, Cmds: string(cmds)})
+
+	log.Printf("Robot %s: Rerouted task %s around blocked cell to (%d, %d): \"%s\"", r.id, task.id, x, y, string(path))
+	r.warehouse.publish(Event{Type: EventRobotRerouted, RobotID: r.id, TaskID: task.id, X: x, Y: y, State: r.state})
+	return errRerouted
+}
+
+// publishBlockedMove publishes an event for the cell a blocked command is trying to enter, naming its occupant,
+// and returns the occupant's ID.
+func (r *robotImpl) publishBlockedMove(eventType EventType, taskID string, cmd rune) string {
+	r.warehouse.mu.RLock()
+	defer r.warehouse.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	x, y := moveTarget(r.state.X, r.state.Y, cmd)
+	blockedBy := ""
+	if r.warehouse.inBounds(x, y) {
+		blockedBy = r.warehouse.gridyx[y][x]
+	}
+	r.warehouse.publish(Event{Type: eventType, RobotID: r.id, TaskID: taskID, X: x, Y: y, State: r.state, BlockedBy: blockedBy})
+	return blockedBy
+}
+
+// isMove reports whether the command moves the robot.
+func isMove(cmd rune) bool {
+	switch cmd {
+	case 'N', 'S', 'E', 'W', MoveNorthEast, MoveNorthWest, MoveSouthEast, MoveSouthWest:
+		return true
+	}
+	return false
+}
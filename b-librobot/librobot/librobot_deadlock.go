@@ -0,0 +1,158 @@
+package librobot
+
+import (
+	"log"
+	"sync"
+)
+
+// Deadlock detection among robots waiting on each other under the CollisionWait and CollisionRetry policies
+
+// DeadlockStrategy identifies how a deadlock between waiting robots is broken.
+type DeadlockStrategy string
+
+// Deadlock strategies
+const (
+	DeadlockAbort   DeadlockStrategy = "abort"   // Abort the victim's task with ErrDeadlock
+	DeadlockBackOff DeadlockStrategy = "backoff" // Move the victim aside, then plan its way around the others
+)
+
+// WithDeadlockStrategy sets how the warehouse breaks deadlocks. The default is DeadlockAbort.
+// In each deadlock the victim is the robot with the lowest priority; on equal priorities,
+// it is the robot whose wait completed the cycle.
+func WithDeadlockStrategy(s DeadlockStrategy) WarehouseOption {
+	return func(w *warehouseImpl) {
+		w.deadlocks.strategy = s
+	}
+}
+
+// deadlockDetector maintains the wait-for graph of robots blocked by the occupants of the cells they are moving to
+type deadlockDetector struct {
+	mu       sync.Mutex
+	waitsFor map[string]string // Robot ID of the occupant each waiting robot is blocked by
+	strategy DeadlockStrategy
+}
+
+// newDeadlockDetector creates a detector with no waiting robots.
+func newDeadlockDetector() *deadlockDetector {
+	return &deadlockDetector{waitsFor: make(map[string]string), strategy: DeadlockAbort}
+}
+
+// wait records that the robot is waiting for blockedBy, and returns the cycle of waiting robots it completes, if any,
+// starting with the robot.
+func (d *deadlockDetector) wait(robotID, blockedBy string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.waitsFor[robotID] = blockedBy
+	cycle := []string{robotID}
+	for next, ok := blockedBy, blockedBy != ""; ok; next, ok = d.waitsFor[next] {
+		if next == robotID {
+			return cycle
+		}
+		for _, id := range cycle {
+			if id == next {
+				return nil // A cycle which does not include this robot was found before
+			}
+		}
+		cycle = append(cycle, next)
+	}
+	return nil
+}
+
+// done records that the robot is no longer waiting.
+func (d *deadlockDetector) done(robotID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.waitsFor, robotID)
+}
+
+// detectDeadlock records that the robot is waiting for blockedBy. If that completes a cycle of waiting robots,
+// it chooses a victim, publishes EventDeadlockDetected and tells the victim to give way.
+func (r *robotImpl) detectDeadlock(blockedBy string) {
+	detector := r.warehouse.deadlocks
+	cycle := detector.wait(r.id, blockedBy)
+	if cycle == nil {
+		return
+	}
+
+	// The victim is the robot with the lowest priority; the first in the cycle wins ties
+	r.warehouse.mu.RLock()
+	victim := r
+	for _, id := range cycle[1:] {
+		if robot, ok := r.warehouse.robots[id]; ok && robot.currentPriority() < victim.currentPriority() {
+			victim = robot
+		}
+	}
+	r.warehouse.mu.RUnlock()
+
+	// Stop the victim taking part in another cycle until it has given way
+	detector.done(victim.id)
+	log.Printf("Deadlock detected between robots %v; robot %s gives way (%s)", cycle, victim.id, detector.strategy)
+	r.warehouse.publish(Event{Type: EventDeadlockDetected, RobotID: victim.id, Robots: cycle})
+
+	select {
+	case victim.deadlock <- detector.strategy:
+	default:
+		// The victim has already been told
+	}
+}
+
+// endWait records that the robot is no longer waiting, and discards any deadlock resolution it was not needed for.
+func (r *robotImpl) endWait() {
+	r.warehouse.deadlocks.done(r.id)
+	select {
+	case <-r.deadlock:
+	default:
+	}
+}
+
+// currentPriority returns the robot's priority.
+func (r *robotImpl) currentPriority() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.priority
+}
+
+// resolveDeadlock makes the robot give way in a deadlock while executing task.cmds[i].
+// With DeadlockBackOff, the robot steps into a free neighbouring cell, waits a command period for the others to pass,
+// then plans a path around them to where its run of moves would have taken it, returning errRerouted.
+// With reservations, the cell backed off into is reserved like any other step; if the only free cells are reserved
+// by other robots, the robot keeps waiting instead and errKeepWaiting is returned.
+// It returns ErrDeadlock if the task is aborted, or ErrTaskCancelled if the task is cancelled while waiting.
+func (r *robotImpl) resolveDeadlock(task *robotTask, i int, strategy DeadlockStrategy) error {
+	if strategy != DeadlockBackOff {
+		return ErrDeadlock
+	}
+
+	state := r.CurrentState()
+	moves := cardinalMoves
+	if r.isDiagonal {
+		moves = append(append([]rune{}, cardinalMoves...), diagonalMoves...)
+	}
+	reserved := false // Whether a cell was passed over for being reserved
+	for _, move := range moves {
+		if !r.reserveBackOff(move) {
+			reserved = true
+			continue
+		}
+		if r.executeCommand(task.id, move) != nil {
+			continue
+		}
+		log.Printf("Robot %s: Backed off to (%d, %d)", r.id, r.CurrentState().X, r.CurrentState().Y)
+		timer := r.warehouse.clock.NewTimer(CommandExecutionTime)
+		select {
+		case <-timer.C():
+		case <-task.cancelCh:
+			timer.Stop()
+			return ErrTaskCancelled
+		}
+		return r.reroute(task, i, state.X, state.Y)
+	}
+	if reserved {
+		// The back-off reservations are of no use; the task's are taken again before its next step
+		r.warehouse.reservations.release(r.id)
+		log.Printf("Robot %s: Free cells to back off to are reserved; waiting instead", r.id)
+		return errKeepWaiting
+	}
+	return ErrDeadlock // Nowhere to back off to
+}
@@ -1,6 +1,9 @@
 package librobot
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Errors for test validation
 var (
@@ -9,9 +12,15 @@ var (
 	// ErrPositionOccupied indicates that the target position is already occupied by another robot.
 	ErrPositionOccupied = errors.New("target position already occupied by another robot")
 	// ErrRobotNotFound indicates that a specified robot ID was not found in the warehouse.
-	ErrRobotNotFound = errors.New("robot not found") // Currently not returned by any public method, but useful if we add GetRobot(id string)
+	ErrRobotNotFound = errors.New("robot not found")
+	// ErrWarehouseClosed indicates that the warehouse has been closed and accepts no more robots or tasks.
+	ErrWarehouseClosed = errors.New("warehouse closed")
+	// ErrRobotRemoved indicates that the robot has been, or is being, removed from the warehouse.
+	ErrRobotRemoved = errors.New("robot removed from the warehouse")
 	// ErrTaskNotFound indicates that a specified task ID was not found for the robot.
 	ErrTaskNotFound = errors.New("task not found")
+	// ErrTaskCancelled indicates that a task was cancelled before it completed.
+	ErrTaskCancelled = errors.New("task cancelled")
 	// ErrCrateNotFound indicates that no crate exists at the specified location.
 	ErrCrateNotFound = errors.New("crate not found at specified location")
 	// ErrCrateExists indicates that a crate already exists at the specified location.
@@ -24,4 +33,51 @@ var (
 	ErrRobotNotCrate = errors.New("robot is not carrying a crate")
 	// ErrCrateOutOfBounds indicates that the crate is outside of the warehouse grid
 	ErrCrateOutOfBounds = errors.New("crate out of bounds")
+	// ErrObstacle indicates that the position is blocked by a static obstacle.
+	ErrObstacle = errors.New("position blocked by an obstacle")
+	// ErrObstacleNotFound indicates that no obstacle exists at the specified location.
+	ErrObstacleNotFound = errors.New("obstacle not found at specified location")
+	// ErrChargerNotFound indicates that no charger exists at the specified location.
+	ErrChargerNotFound = errors.New("charger not found at specified location")
+	// ErrChargerExists indicates that a charger already exists at the specified location.
+	ErrChargerExists = errors.New("charger already exists at specified location")
+	// ErrNotOnCharger indicates that a robot was told to charge away from a charger.
+	ErrNotOnCharger = errors.New("robot is not on a charger")
+	// ErrBatteryDepleted indicates that a robot does not have enough charge left for its next move.
+	ErrBatteryDepleted = errors.New("battery depleted")
+	// ErrNoPath indicates that there is no route to the requested position.
+	ErrNoPath = errors.New("no path to target position")
+	// ErrTaskInterrupted indicates that a task was interrupted by a restart and discarded when the journal was replayed.
+	ErrTaskInterrupted = errors.New("task interrupted by a restart")
+	// ErrEmergencyStop indicates that a task was interrupted, or rejected, because the warehouse is emergency stopped.
+	ErrEmergencyStop = errors.New("warehouse emergency stopped")
+	// ErrQueueFull indicates that a task was rejected because the robot's queue is full.
+	ErrQueueFull = errors.New("task queue is full")
+	// ErrTaskPreempted indicates that a task was aborted to make way for a task of higher priority.
+	ErrTaskPreempted = errors.New("task preempted by a task of higher priority")
+	// ErrDeadlock indicates that a task was aborted to break a deadlock between waiting robots.
+	ErrDeadlock = errors.New("task aborted to break a deadlock")
+	// ErrInvalidLayout indicates that a warehouse layout could not be parsed or loaded.
+	ErrInvalidLayout = errors.New("invalid warehouse layout")
+	// ErrInvalidSnapshot indicates that a warehouse snapshot could not be restored.
+	ErrInvalidSnapshot = errors.New("invalid warehouse snapshot")
+	// ErrInvalidCommand indicates that a command string contains a command the robot does not understand.
+	// The error returned is a *ParseError, which wraps ErrInvalidCommand.
+	ErrInvalidCommand = errors.New("invalid command")
 )
+
+// ParseError reports an invalid command found when a task is enqueued.
+type ParseError struct {
+	Command rune   // The invalid command
+	Offset  int    // Position of the command in the command string, counted in characters from 0
+	Input   string // The full command string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v %q at offset %d", ErrInvalidCommand, e.Command, e.Offset)
+}
+
+// Unwrap allows errors.Is(err, ErrInvalidCommand).
+func (e *ParseError) Unwrap() error {
+	return ErrInvalidCommand
+}
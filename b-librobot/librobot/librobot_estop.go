@@ -0,0 +1,131 @@
+package librobot
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Emergency stop of every robot in a warehouse, and the incident report it leaves
+
+// Incident records the state of a warehouse at the moment it was emergency stopped.
+type Incident struct {
+	Time   time.Time       `json:"time"`   // Time from the warehouse clock
+	Robots []RobotIncident `json:"robots"` // In robot ID order
+}
+
+// RobotIncident records the state of a robot at the moment its warehouse was emergency stopped.
+type RobotIncident struct {
+	RobotID          string     `json:"robot_id"`
+	State            RobotState `json:"state"`
+	TaskID           string     `json:"task_id,omitempty"`           // Running task, interrupted by the stop
+	CommandsExecuted int        `json:"commands_executed,omitempty"` // Commands of the running task executed before the stop
+	Cancelled        []string   `json:"cancelled,omitempty"`         // Queued tasks, cancelled by the stop
+}
+
+// EmergencyStop halts every robot in the warehouse at once, and returns the state of each robot at that moment.
+// Each running task stops without finishing its current command and ends as TaskInterrupted with ErrEmergencyStop;
+// queued tasks are cancelled. New tasks are rejected with ErrEmergencyStop until Reset is called.
+// Stopping a warehouse which is already stopped returns the incident of the first stop.
+func (w *warehouseImpl) EmergencyStop() Incident {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if incident := w.incident.Load(); incident != nil {
+		return incident.clone()
+	}
+
+	incident := &Incident{Time: w.clock.Now()}
+	w.incident.Store(incident) // No more tasks are queued from here
+	robots := make([]*robotImpl, 0, len(w.robots))
+	for _, r := range w.robots {
+		robots = append(robots, r)
+	}
+	slices.SortFunc(robots, func(a, b *robotImpl) int { return strings.Compare(a.id, b.id) })
+	for _, r := range robots {
+		incident.Robots = append(incident.Robots, r.interruptTasks())
+	}
+
+	log.Printf("Emergency stop: %d robots halted.", len(robots))
+	w.publish(Event{Type: EventEmergencyStop})
+	w.record(journalEntry{Op: journalEStop, Incident: incident})
+	return incident.clone()
+}
+
+// Reset clears an emergency stop, so the warehouse accepts tasks again. Resetting a warehouse which is not stopped
+// has no effect.
+func (w *warehouseImpl) Reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.incident.Load() == nil {
+		return
+	}
+	w.incident.Store(nil)
+	log.Printf("Emergency stop reset.")
+	w.publish(Event{Type: EventEmergencyReset})
+	w.record(journalEntry{Op: journalEStop})
+}
+
+// Incident returns the incident report of the warehouse's emergency stop, if it is stopped.
+func (w *warehouseImpl) Incident() (Incident, bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	incident := w.incident.Load()
+	if incident == nil {
+		return Incident{}, false
+	}
+	return incident.clone(), true
+}
+
+// clone returns a copy of the incident which shares nothing with it.
+func (i *Incident) clone() Incident {
+	c := Incident{Time: i.Time, Robots: slices.Clone(i.Robots)}
+	for j := range c.Robots {
+		c.Robots[j].Cancelled = slices.Clone(c.Robots[j].Cancelled)
+	}
+	return c
+}
+
+// interruptTasks stops the robot's running task and cancels its queued tasks for an emergency stop,
+// and returns the robot's state.
+func (r *robotImpl) interruptTasks() RobotIncident {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := RobotIncident{RobotID: r.id, State: r.state}
+	for _, task := range slices.Clone(r.pending) {
+		if _, ok := r.cancelChannels[task.id]; !ok {
+			continue // Already cancelled
+		}
+		if task.state == TaskRunning {
+			report.TaskID = task.id
+			report.CommandsExecuted = task.executed
+			task.interrupted = true // Ended by the worker once it sees the cancellation
+		} else {
+			report.Cancelled = append(report.Cancelled, task.id)
+		}
+		r.cancelTask(task.id)
+	}
+	log.Printf("Robot %s: Emergency stop at (%d, %d); task %q interrupted, %d queued tasks cancelled.",
+		r.id, r.state.X, r.state.Y, report.TaskID, len(report.Cancelled))
+	return report
+}
+
+// stopCancelled ends a running task which was cancelled, after the given number of commands. A task stopped by an
+// emergency stop is interrupted rather than cancelled.
+func (r *robotImpl) stopCancelled(task *robotTask, executed int) {
+	r.mu.Lock()
+	state, err := TaskCancelled, ErrTaskCancelled
+	if task.interrupted {
+		state, err = TaskInterrupted, ErrEmergencyStop
+	}
+	r.mu.Unlock()
+
+	log.Printf("Robot %s: Task %s %s after %d commands.", r.id, task.id, state, executed)
+	r.finishTask(task, state, 0, err)
+	select {
+	case task.errorCh <- err:
+	default:
+		// Error channel might not be listened to.
+	}
+}
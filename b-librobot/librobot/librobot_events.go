@@ -0,0 +1,128 @@
+package librobot
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// EventType identifies the kind of state change described by an Event.
+type EventType string
+
+// Event types published by a warehouse
+const (
+	EventRobotAdded         EventType = "robot.added"         // A robot was added to the warehouse
+	EventRobotRemoved       EventType = "robot.removed"       // A robot was removed with RemoveRobot
+	EventRobotPaused        EventType = "robot.paused"        // A robot was paused with Robot.Pause
+	EventRobotResumed       EventType = "robot.resumed"       // A robot was resumed with Robot.Resume
+	EventWarehousePaused    EventType = "warehouse.paused"    // The warehouse was paused with Warehouse.Pause
+	EventWarehouseResumed   EventType = "warehouse.resumed"   // The warehouse was resumed with Warehouse.Resume
+	EventEmergencyStop      EventType = "warehouse.stopped"   // Every robot was halted with Warehouse.EmergencyStop
+	EventEmergencyReset     EventType = "warehouse.reset"     // The emergency stop was cleared with Warehouse.Reset
+	EventRobotMoved         EventType = "robot.moved"         // A robot moved to a new cell
+	EventRobotBlocked       EventType = "robot.blocked"       // A robot could not move because the cell is occupied
+	EventRobotWaiting       EventType = "robot.waiting"       // A blocked robot is waiting to try the move again
+	EventRobotRerouted      EventType = "robot.rerouted"      // A blocked robot planned a path around the blocking robot
+	EventRobotYielded       EventType = "robot.yielded"       // A robot is waiting a tick for cells reserved by a robot with higher priority
+	EventReservationRevoked EventType = "reservation.revoked" // A robot's cell reservations were taken over by a robot with higher priority
+	EventDeadlockDetected   EventType = "deadlock.detected"   // Robots were found waiting on each other in a cycle
+	EventTaskQueued         EventType = "task.queued"         // A task was added to a robot's queue
+	EventTaskStarted        EventType = "task.started"        // A robot started executing a task
+	EventTaskCompleted      EventType = "task.completed"      // A task finished successfully
+	EventTaskFailed         EventType = "task.failed"         // A task was aborted by a command error
+	EventTaskCancelled      EventType = "task.cancelled"      // A task was cancelled
+	EventTaskPreempted      EventType = "task.preempted"      // A running task was suspended for a task of higher priority
+	EventTaskInterrupted    EventType = "task.interrupted"    // A running task was stopped by an emergency stop
+	EventCrateAdded         EventType = "crate.added"         // A crate was added with AddCrate
+	EventCrateRemoved       EventType = "crate.removed"       // A crate was removed with DelCrate
+	EventCrateGrabbed       EventType = "crate.grabbed"       // A robot picked up a crate
+	EventCrateDropped       EventType = "crate.dropped"       // A robot dropped a crate
+	EventRobotCharged       EventType = "robot.charged"       // A robot filled its battery at a charger
+	EventObstacleAdded      EventType = "obstacle.added"      // An obstacle was added with AddObstacle
+	EventObstacleRemoved    EventType = "obstacle.removed"    // An obstacle was removed with DelObstacle
+	EventChargerAdded       EventType = "charger.added"       // A charger was added with AddCharger
+	EventChargerRemoved     EventType = "charger.removed"     // A charger was removed with DelCharger
+)
+
+// EventBufferSize is the number of events buffered for each subscriber.
+// Events are dropped for a subscriber which falls this far behind, so the simulation is never held up.
+const EventBufferSize = 256
+
+// Event describes a state change in a warehouse.
+type Event struct {
+	Seq       uint64     // Sequence number, increasing by one for each event published by the warehouse
+	Time      time.Time  // Time from the warehouse clock
+	Type      EventType  // Kind of event
+	RobotID   string     // Robot involved, if any
+	TaskID    string     // Task involved, if any
+	X         uint       // X coordinate of the cell involved; for robot.blocked and robot.waiting, the cell the robot tried to enter; for robot.rerouted, the end of the detour
+	Y         uint       // Y coordinate of the cell involved
+	State     RobotState // State of the robot after the event, for robot and task events
+	BlockedBy string     // ID of the robot occupying the cell, for robot.blocked and robot.waiting; the robot holding or taking the reservations, for robot.yielded and reservation.revoked
+	Err       error      // Error which ended the task, for task.failed, task.cancelled and task.interrupted
+	Robots    []string   // Robots waiting on each other, for deadlock.detected; RobotID is the robot giving way
+}
+
+// eventSubscriber receives events of the requested types
+type eventSubscriber struct {
+	types map[EventType]bool // Empty to receive every type
+	ch    chan Event
+}
+
+// eventBus delivers warehouse events to subscribers
+type eventBus struct {
+	mu          sync.Mutex
+	seq         uint64
+	subscribers map[*eventSubscriber]struct{}
+}
+
+// newEventBus creates a bus with no subscribers.
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[*eventSubscriber]struct{})}
+}
+
+// Subscribe returns a channel which receives the warehouse's events of the given types, or every event if none are given.
+// Call the returned cancel function to stop receiving events; the channel is then closed.
+func (w *warehouseImpl) Subscribe(types ...EventType) (<-chan Event, func()) {
+	sub := &eventSubscriber{types: make(map[EventType]bool), ch: make(chan Event, EventBufferSize)}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	w.events.mu.Lock()
+	w.events.subscribers[sub] = struct{}{}
+	w.events.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			w.events.mu.Lock()
+			delete(w.events.subscribers, sub)
+			close(sub.ch)
+			w.events.mu.Unlock()
+		})
+	}
+	return sub.ch, cancel
+}
+
+// publish stamps the event with the next sequence number and the clock time, and sends it to every interested subscriber.
+// It never blocks, so it is safe to call while holding the warehouse or robot locks.
+func (w *warehouseImpl) publish(ev Event) {
+	w.events.mu.Lock()
+	defer w.events.mu.Unlock()
+
+	w.events.seq++
+	ev.Seq = w.events.seq
+	ev.Time = w.clock.Now()
+
+	for sub := range w.events.subscribers {
+		if len(sub.types) > 0 && !sub.types[ev.Type] {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			log.Printf("Event subscriber is not keeping up; dropped event %d (%s)", ev.Seq, ev.Type)
+		}
+	}
+}
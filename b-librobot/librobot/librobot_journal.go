@@ -0,0 +1,407 @@
+package librobot
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Durable write-ahead journal of robots and tasks, replayed when a warehouse is created
+
+// RecoveryPolicy decides what happens to a task which was half finished when the journal was last written.
+type RecoveryPolicy string
+
+// Recovery policies
+const (
+	RecoverResume  RecoveryPolicy = "resume"  // Re-queue the task from its next command
+	RecoverRestart RecoveryPolicy = "restart" // Re-queue the task from its first command, from where the robot stopped
+	RecoverDiscard RecoveryPolicy = "discard" // Fail the task with ErrTaskInterrupted
+)
+
+// WithJournal keeps a journal of the warehouse at path on local disk. Every robot, crate, obstacle and charger change,
+// and the enqueue, start, progress, completion and cancellation of every task, is written and synced before the call
+// making it returns. If the journal exists when the warehouse is created, it is replayed: robots, crates, obstacles
+// and chargers are restored, and unfinished tasks are queued again with their IDs. Tasks which had started are
+// handled by recovery. The journal is then rewritten to hold only the restored state.
+func WithJournal(path string, recovery RecoveryPolicy) WarehouseOption {
+	return func(w *warehouseImpl) {
+		w.journalPath = path
+		w.recovery = recovery
+	}
+}
+
+// Journal operations
+const (
+	journalRobot       = "robot"        // A robot was added, or its state was set
+	journalRemove      = "robot.remove" // A robot was removed
+	journalPause       = "pause"        // A robot, or the warehouse if no robot is given, was paused or resumed
+	journalEStop       = "estop"        // The warehouse was emergency stopped, or reset if no incident is given
+	journalCrateAdd    = "crate.add"    // A crate was added
+	journalCrateDel    = "crate.del"    // A crate was removed
+	journalObstacleAdd = "obstacle.add" // An obstacle was added
+	journalObstacleDel = "obstacle.del" // An obstacle was removed
+	journalChargerAdd  = "charger.add"  // A charger was added
+	journalChargerDel  = "charger.del"  // A charger was removed
+	journalQueue       = "task.queue"   // A task was queued
+	journalStart       = "task.start"   // A task was started
+	journalCommand     = "task.command" // A robot executed a command
+	journalReroute     = "task.reroute" // A task's commands were replaced by a detour
+	journalSuspend     = "task.suspend" // A running task was suspended by a task of higher priority
+	journalReorder     = "task.reorder" // The queued tasks were put in a new order
+	journalFinish      = "task.finish"  // A task completed, failed, was cancelled or was interrupted
+)
+
+// journalEntry is a line of the journal
+type journalEntry struct {
+	Op            string       `json:"op"`
+	Time          time.Time    `json:"time"`
+	Robot         string       `json:"robot,omitempty"`
+	Task          string       `json:"task,omitempty"`
+	X             uint         `json:"x,omitempty"`               // Crate, obstacle and charger operations
+	Y             uint         `json:"y,omitempty"`               // Crate, obstacle and charger operations
+	State         RobotState   `json:"state"`                     // Robot state after robot and command operations
+	Diagonal      bool         `json:"diagonal,omitempty"`        // Robot operations
+	CanPickCrates bool         `json:"can_pick_crates,omitempty"` // Robot operations
+	Commands      string       `json:"commands,omitempty"`        // Queue operations
+	Cmds          string       `json:"cmds,omitempty"`            // Queue and reroute operations
+	Cmd           string       `json:"cmd,omitempty"`             // Command operations
+	Executed      int          `json:"executed,omitempty"`        // Queue and command operations; zero for commands outside the task
+	Priority      TaskPriority `json:"priority,omitempty"`        // Queue operations
+	Tasks         []string     `json:"tasks,omitempty"`           // Reorder operations; the queued tasks in their new order
+	Paused        bool         `json:"paused,omitempty"`          // Pause operations; false when resumed
+	Incident      *Incident    `json:"incident,omitempty"`        // Emergency stop operations; nil when reset
+	TaskState     TaskState    `json:"task_state,omitempty"`      // Finish operations
+}
+
+// journal appends entries to the journal file
+type journal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// record appends an entry to the journal and syncs it to disk. It does nothing if the warehouse has no journal,
+// or it has been closed.
+func (w *warehouseImpl) record(e journalEntry) {
+	if w.journal == nil {
+		return
+	}
+	e.Time = w.clock.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Journal: %v", err)
+		return
+	}
+
+	w.journal.mu.Lock()
+	defer w.journal.mu.Unlock()
+	if w.journal.file == nil {
+		return // Closed
+	}
+	if _, err := w.journal.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Journal: %v", err)
+		return
+	}
+	if err := w.journal.file.Sync(); err != nil {
+		log.Printf("Journal: %v", err)
+	}
+}
+
+// recordRobot records the robot's type and state. The robot's mutex must be held.
+func (r *robotImpl) recordRobot() {
+	r.warehouse.record(journalEntry{Op: journalRobot, Robot: r.id, State: r.state, Diagonal: r.isDiagonal, CanPickCrates: r.canPickCrates})
+}
+
+// recordTask records a queued task, with the commands it has already executed. The robot's mutex must be held.
+func (r *robotImpl) recordTask(task *robotTask) {
+	r.warehouse.record(journalEntry{
+		Op:       journalQueue,
+		Robot:    r.id,
+		Task:     task.id,
+		Commands: task.commands,
+		Cmds:     string(task.cmds),
+		Executed: task.executed,
+		Priority: task.priority,
+	})
+}
+
+// openJournal replays the warehouse's journal, rewrites it with the restored state and starts the restored robots.
+// It is called when the warehouse is created, before it is shared.
+func (w *warehouseImpl) openJournal() {
+	if w.journalPath == "" {
+		return
+	}
+
+	if err := w.replayJournal(); err != nil {
+		log.Printf("Journal %s: %v; the rest of the journal is ignored", w.journalPath, err)
+	}
+
+	// Recover the tasks which had started
+	queued := make(map[*robotImpl][]*robotTask)
+	for _, r := range w.robots {
+		for _, task := range r.pending {
+			if w.incident.Load() != nil {
+				// Stopped before the end of the task was recorded
+				task.end(TaskInterrupted, 0, ErrEmergencyStop, w.clock.Now(), r.state)
+				r.tasks[task.id] = task
+				continue
+			}
+			if task.state == TaskRunning {
+				switch w.recovery {
+				case RecoverRestart:
+					if cmds, err := r.prepareCommands(task.commands); err == nil {
+						task.cmds = cmds // Drop any detour
+					}
+					task.executed = 0
+				case RecoverDiscard:
+					task.end(TaskFailed, 0, ErrTaskInterrupted, w.clock.Now(), r.state)
+					r.tasks[task.id] = task
+					log.Printf("Robot %s: Discarded interrupted task %s", r.id, task.id)
+					continue
+				}
+				task.state = TaskQueued
+			}
+			queued[r] = append(queued[r], task)
+		}
+		r.pending = nil
+	}
+
+	// Rewrite the journal with the restored state, so it does not grow without bound
+	tmp := w.journalPath + ".tmp"
+	file, err := os.Create(tmp)
+	if err == nil {
+		w.journal = &journal{file: file}
+		for y := uint(0); y < w.height; y++ {
+			for x := uint(0); x < w.width; x++ {
+				if w.obstaclesyx[y][x] {
+					w.record(journalEntry{Op: journalObstacleAdd, X: x, Y: y})
+				}
+				if w.cratesyx[y][x] {
+					w.record(journalEntry{Op: journalCrateAdd, X: x, Y: y})
+				}
+				if w.chargersyx[y][x] {
+					w.record(journalEntry{Op: journalChargerAdd, X: x, Y: y})
+				}
+			}
+		}
+		if paused, _ := w.pause.state(); paused {
+			w.record(journalEntry{Op: journalPause, Paused: true})
+		}
+		if incident := w.incident.Load(); incident != nil {
+			w.record(journalEntry{Op: journalEStop, Incident: incident})
+		}
+		for _, r := range w.robots {
+			r.recordRobot()
+			if paused, _ := r.pause.state(); paused {
+				w.record(journalEntry{Op: journalPause, Robot: r.id, Paused: true})
+			}
+		}
+		err = os.Rename(tmp, w.journalPath)
+	}
+	if err != nil {
+		log.Printf("Journal %s: %v; the warehouse is not journalled", w.journalPath, err)
+		if file != nil {
+			file.Close()
+		}
+		w.journal = nil
+	}
+
+	for _, r := range w.robots {
+		go r.startWorker()
+		for _, task := range queued[r] {
+			r.queueTask(task, true)
+		}
+		log.Printf("Robot %s restored from journal at (%d, %d) with %d tasks", r.id, r.state.X, r.state.Y, len(queued[r]))
+	}
+}
+
+// replayJournal applies the entries of the journal to the warehouse. A missing journal is empty.
+// A truncated last line, left by a crash while writing, is ignored.
+func (w *warehouseImpl) replayJournal() error {
+	file, err := os.Open(w.journalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	var pendingErr error
+	for line := 1; scanner.Scan(); line++ {
+		if pendingErr != nil {
+			return pendingErr
+		}
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			pendingErr = fmt.Errorf("line %d: %w", line, err) // Only an error if it is not the last line
+			continue
+		}
+		if err := w.applyJournalEntry(e); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// applyJournalEntry applies a journal entry to the warehouse.
+func (w *warehouseImpl) applyJournalEntry(e journalEntry) error {
+	switch e.Op {
+	case journalCrateAdd, journalCrateDel, journalObstacleAdd, journalObstacleDel, journalChargerAdd, journalChargerDel:
+		if !w.inBounds(e.X, e.Y) {
+			return ErrOutOfBounds
+		}
+		switch e.Op {
+		case journalCrateAdd, journalCrateDel:
+			w.cratesyx[e.Y][e.X] = e.Op == journalCrateAdd
+		case journalChargerAdd, journalChargerDel:
+			w.chargersyx[e.Y][e.X] = e.Op == journalChargerAdd
+		default:
+			w.obstaclesyx[e.Y][e.X] = e.Op == journalObstacleAdd
+		}
+		return nil
+
+	case journalRobot:
+		r, ok := w.robots[e.Robot]
+		if !ok {
+			r = w.newRobot(e.Robot, e.State.X, e.State.Y, e.CanPickCrates)
+			r.isDiagonal = e.Diagonal
+			w.robots[e.Robot] = r
+		}
+		return w.moveJournalRobot(r, e.State)
+
+	case journalEStop:
+		w.incident.Store(e.Incident)
+		return nil
+
+	case journalPause:
+		if e.Robot == "" {
+			w.pause.set(e.Paused)
+			return nil
+		}
+		r, ok := w.robots[e.Robot]
+		if !ok {
+			return fmt.Errorf("%s for unknown robot %q", e.Op, e.Robot)
+		}
+		r.pause.set(e.Paused)
+		return nil
+
+	case journalRemove:
+		r, ok := w.robots[e.Robot]
+		if !ok {
+			return fmt.Errorf("%s for unknown robot %q", e.Op, e.Robot)
+		}
+		if w.gridyx[r.state.Y][r.state.X] == r.id {
+			w.gridyx[r.state.Y][r.state.X] = ""
+		}
+		delete(w.robots, e.Robot)
+		return nil
+	}
+
+	r, ok := w.robots[e.Robot]
+	if !ok {
+		return fmt.Errorf("%s for unknown robot %q", e.Op, e.Robot)
+	}
+	var task *robotTask
+	for _, pending := range r.pending {
+		if pending.id == e.Task {
+			task = pending
+		}
+	}
+	if task == nil && e.Op != journalQueue && e.Task != "" {
+		return fmt.Errorf("%s for unknown task %q", e.Op, e.Task)
+	}
+
+	switch e.Op {
+	case journalQueue:
+		cmds, err := parseCommands(e.Cmds, r.isDiagonal)
+		if err != nil || e.Executed > len(cmds) {
+			return fmt.Errorf("invalid commands for task %q", e.Task)
+		}
+		r.insertPending(restoredTask(e.Task, e.Commands, cmds, e.Executed, e.Priority, e.Time))
+	case journalStart:
+		task.state = TaskRunning
+	case journalSuspend:
+		task.state = TaskQueued
+		r.removePending(task)
+		r.insertPending(task)
+	case journalReorder:
+		order := make([]*robotTask, 0, len(e.Tasks))
+		for _, taskID := range e.Tasks {
+			i := slices.IndexFunc(r.pending, func(t *robotTask) bool { return t.id == taskID && t.state == TaskQueued })
+			if i < 0 {
+				return fmt.Errorf("%s for unknown task %q", e.Op, taskID)
+			}
+			order = append(order, r.pending[i])
+		}
+		if len(order) != len(r.queuedTasks()) {
+			return fmt.Errorf("%s does not list every queued task", e.Op)
+		}
+		r.reorderPending(order)
+	case journalCommand:
+		if err := w.moveJournalRobot(r, e.State); err != nil {
+			return err
+		}
+		switch e.Cmd {
+		case "G":
+			w.cratesyx[e.State.Y][e.State.X] = false
+		case "D":
+			w.cratesyx[e.State.Y][e.State.X] = true
+		}
+		if task != nil && e.Executed > 0 {
+			task.executed = e.Executed
+		}
+	case journalReroute:
+		cmds, err := parseCommands(e.Cmds, r.isDiagonal)
+		if err != nil {
+			return fmt.Errorf("invalid commands for task %q", e.Task)
+		}
+		task.cmds = cmds
+	case journalFinish:
+		r.removePending(task)
+	default:
+		return fmt.Errorf("unknown operation %q", e.Op)
+	}
+	return nil
+}
+
+// moveJournalRobot places a robot being replayed in the given state.
+func (w *warehouseImpl) moveJournalRobot(r *robotImpl, state RobotState) error {
+	if !w.inBounds(state.X, state.Y) {
+		return ErrOutOfBounds
+	}
+	if occupant := w.gridyx[state.Y][state.X]; occupant != "" && occupant != r.id {
+		return ErrPositionOccupied
+	}
+	if w.gridyx[r.state.Y][r.state.X] == r.id {
+		w.gridyx[r.state.Y][r.state.X] = ""
+	}
+	w.gridyx[state.Y][state.X] = r.id
+	r.state = state
+	return nil
+}
+
+// restoredTask creates a queued task restored from a snapshot or journal, which resumes after the executed commands.
+// Its position and error channels have no listeners.
+func restoredTask(id, commands string, cmds []rune, executed int, priority TaskPriority, queuedAt time.Time) *robotTask {
+	return &robotTask{
+		id:         id,
+		commands:   commands,
+		positionCh: make(chan RobotState),
+		errorCh:    make(chan error, 1),
+		cancelCh:   make(chan struct{}),
+		done:       make(chan struct{}),
+		cmds:       cmds,
+		state:      TaskQueued,
+		executed:   executed,
+		priority:   priority,
+		queuedAt:   queuedAt,
+	}
+}
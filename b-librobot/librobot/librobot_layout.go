@@ -0,0 +1,304 @@
+package librobot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Warehouse layouts, loaded from text or JSON map files
+
+// Position is a cell in the warehouse grid.
+type Position struct {
+	X uint `json:"x"`
+	Y uint `json:"y"`
+}
+
+// Layout describes a warehouse scenario: the grid size, obstacles, crates, chargers, robots and named locations.
+type Layout struct {
+	Width     uint                `json:"width"`  // Zero for GridSize
+	Height    uint                `json:"height"` // Zero for GridSize
+	Obstacles []Position          `json:"obstacles,omitempty"`
+	Crates    []Position          `json:"crates,omitempty"`
+	Chargers  []Position          `json:"chargers,omitempty"`
+	Robots    []LayoutRobot       `json:"robots,omitempty"`
+	Locations map[string]Position `json:"locations,omitempty"` // Named cells, such as docks and charging points
+}
+
+// LayoutRobot describes a robot in a Layout.
+type LayoutRobot struct {
+	ID       string `json:"id"` // Empty for a generated ID
+	X        uint   `json:"x"`
+	Y        uint   `json:"y"`
+	Diagonal bool   `json:"diagonal,omitempty"`  // Added with AddDiagonalRobot
+	HasCrate bool   `json:"has_crate,omitempty"` // Starts carrying a crate
+	Priority int    `json:"priority,omitempty"`  // See Robot.SetPriority
+	Battery  *int   `json:"battery,omitempty"`   // Starting charge, if the warehouse has a battery model; nil for full
+}
+
+// Cells of a text layout, as drawn by Render
+const (
+	layoutEmpty    = " - "
+	layoutCrate    = "[C]"
+	layoutObstacle = "###"
+	layoutCharger  = "[+]"
+)
+
+// ReadLayout reads a layout from a text or JSON map file. See ParseLayout.
+func ReadLayout(path string) (Layout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Layout{}, err
+	}
+	return ParseLayout(data)
+}
+
+// ParseLayout parses a layout in JSON form, if the data starts with '{', or otherwise in text form.
+//
+// The text form is a grid drawn as Render draws it, with the top row first: " - " is an empty cell, "[C]" a crate,
+// "###" an obstacle and "[+]" a charger. A robot is drawn as its two character ID, followed by "_" if it is standing
+// on a crate, "*" if it is carrying one or "+" if it is standing on a charger. Lines starting with "---", such as
+// Render's header and footer, are ignored. The grid may be followed by directives:
+//
+//	diagonal <id>...         the robots are diagonal robots
+//	priority <id> <n>        sets the robot's priority
+//	battery <id> <n>         sets the robot's starting charge
+//	location <name> <x> <y>  names a cell
+//
+// Errors wrap ErrInvalidLayout.
+func ParseLayout(data []byte) (Layout, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var l Layout
+		if err := json.Unmarshal(trimmed, &l); err != nil {
+			return Layout{}, fmt.Errorf("%w: %w", ErrInvalidLayout, err)
+		}
+		return l, nil
+	}
+	return parseTextLayout(string(data))
+}
+
+// parseTextLayout parses a layout in text form.
+func parseTextLayout(text string) (Layout, error) {
+	l := Layout{Locations: make(map[string]Position)}
+	var rows [][]string
+	diagonal := make(map[string]bool)
+	priority := make(map[string]int)
+	battery := make(map[string]int)
+
+	for n, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("%w: line %d: %s", ErrInvalidLayout, n+1, fmt.Sprintf(format, args...))
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(line, "---"):
+			continue
+
+		case fields[0] == "diagonal":
+			for _, id := range fields[1:] {
+				diagonal[id] = true
+			}
+
+		case fields[0] == "priority":
+			if len(fields) != 3 {
+				return Layout{}, fail("expected priority <id> <n>")
+			}
+			p, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return Layout{}, fail("invalid priority %q", fields[2])
+			}
+			priority[fields[1]] = p
+
+		case fields[0] == "battery":
+			if len(fields) != 3 {
+				return Layout{}, fail("expected battery <id> <n>")
+			}
+			b, err := strconv.Atoi(fields[2])
+			if err != nil || b < 0 {
+				return Layout{}, fail("invalid battery %q", fields[2])
+			}
+			battery[fields[1]] = b
+
+		case fields[0] == "location":
+			if len(fields) != 4 {
+				return Layout{}, fail("expected location <name> <x> <y>")
+			}
+			x, errX := strconv.ParseUint(fields[2], 10, 32)
+			y, errY := strconv.ParseUint(fields[3], 10, 32)
+			if errX != nil || errY != nil {
+				return Layout{}, fail("invalid coordinates for location %q", fields[1])
+			}
+			l.Locations[fields[1]] = Position{X: uint(x), Y: uint(y)}
+
+		default:
+			cells, err := splitLayoutRow(line)
+			if err != nil {
+				return Layout{}, fail("%v", err)
+			}
+			if len(rows) > 0 && len(cells) != len(rows[0]) {
+				return Layout{}, fail("row has %d cells, expected %d", len(cells), len(rows[0]))
+			}
+			rows = append(rows, cells)
+		}
+	}
+	if len(rows) == 0 {
+		return Layout{}, fmt.Errorf("%w: no grid rows", ErrInvalidLayout)
+	}
+
+	l.Width, l.Height = uint(len(rows[0])), uint(len(rows))
+	for i, cells := range rows {
+		y := l.Height - 1 - uint(i) // The top row is drawn first
+		for x, cell := range cells {
+			pos := Position{X: uint(x), Y: y}
+			switch cell {
+			case layoutEmpty:
+			case layoutCrate:
+				l.Crates = append(l.Crates, pos)
+			case layoutObstacle:
+				l.Obstacles = append(l.Obstacles, pos)
+			case layoutCharger:
+				l.Chargers = append(l.Chargers, pos)
+			default:
+				robot := LayoutRobot{ID: cell[:2], X: pos.X, Y: pos.Y}
+				switch cell[2:] {
+				case "_":
+					l.Crates = append(l.Crates, pos)
+				case "*":
+					robot.HasCrate = true
+				case "+":
+					l.Chargers = append(l.Chargers, pos)
+				}
+				robot.Diagonal = diagonal[robot.ID]
+				robot.Priority = priority[robot.ID]
+				if b, ok := battery[robot.ID]; ok {
+					robot.Battery = &b
+				}
+				delete(diagonal, robot.ID)
+				delete(priority, robot.ID)
+				delete(battery, robot.ID)
+				l.Robots = append(l.Robots, robot)
+			}
+		}
+	}
+	for id := range diagonal {
+		return Layout{}, fmt.Errorf("%w: diagonal robot %q is not on the grid", ErrInvalidLayout, id)
+	}
+	for id := range priority {
+		return Layout{}, fmt.Errorf("%w: robot %q given a priority is not on the grid", ErrInvalidLayout, id)
+	}
+	for id := range battery {
+		return Layout{}, fmt.Errorf("%w: robot %q given a battery is not on the grid", ErrInvalidLayout, id)
+	}
+	return l, nil
+}
+
+// splitLayoutRow splits a row of a text layout into its cells.
+// Robot cells are two or three characters wide, as drawn by Render. A trailing empty cell may have lost its last space.
+func splitLayoutRow(line string) ([]string, error) {
+	var cells []string
+	for rest := line; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, layoutCrate), strings.HasPrefix(rest, layoutObstacle),
+			strings.HasPrefix(rest, layoutCharger):
+			cells = append(cells, rest[:3])
+			rest = rest[3:]
+		case strings.HasPrefix(rest, " -"):
+			cells = append(cells, layoutEmpty)
+			rest = rest[min(3, len(rest)):]
+		case strings.TrimSpace(rest) == "":
+			rest = ""
+		case len(rest) >= 2 && !strings.ContainsAny(rest[:2], " []#*_+-"):
+			width := 2
+			if len(rest) > 2 && (rest[2] == '_' || rest[2] == '*' || rest[2] == '+') {
+				width = 3
+			}
+			cells = append(cells, rest[:width])
+			rest = rest[width:]
+		default:
+			return nil, fmt.Errorf("unrecognised cell %q", rest[:min(3, len(rest))])
+		}
+	}
+	return cells, nil
+}
+
+// LoadLayout creates a crate warehouse set up as described by the layout, and returns it with its robots by ID.
+// The options are applied as for NewCrateWarehouse, except that the layout's grid size takes precedence.
+// Errors wrap ErrInvalidLayout, along with the error returned when placing the item, such as ErrObstacle.
+func LoadLayout(l Layout, opts ...WarehouseOption) (CrateWarehouse, map[string]Robot, error) {
+	cw := NewCrateWarehouse(append(opts[:len(opts):len(opts)], WithGridSize(l.Width, l.Height))...)
+	wh := cw.(*warehouseImpl)
+	loaded := false
+	defer func() {
+		if !loaded {
+			wh.discard()
+		}
+	}()
+	for name, pos := range l.Locations {
+		if !wh.inBounds(pos.X, pos.Y) {
+			return nil, nil, fmt.Errorf("%w: location %q: %w", ErrInvalidLayout, name, ErrOutOfBounds)
+		}
+	}
+	for _, pos := range l.Obstacles {
+		if err := cw.AddObstacle(pos.X, pos.Y); err != nil {
+			return nil, nil, fmt.Errorf("%w: obstacle at (%d, %d): %w", ErrInvalidLayout, pos.X, pos.Y, err)
+		}
+	}
+	for _, pos := range l.Crates {
+		if err := cw.AddCrate(pos.X, pos.Y); err != nil {
+			return nil, nil, fmt.Errorf("%w: crate at (%d, %d): %w", ErrInvalidLayout, pos.X, pos.Y, err)
+		}
+	}
+	for _, pos := range l.Chargers {
+		if err := cw.AddCharger(pos.X, pos.Y); err != nil {
+			return nil, nil, fmt.Errorf("%w: charger at (%d, %d): %w", ErrInvalidLayout, pos.X, pos.Y, err)
+		}
+	}
+
+	robots := make(map[string]Robot, len(l.Robots))
+	for _, lr := range l.Robots {
+		if _, ok := robots[lr.ID]; ok && lr.ID != "" {
+			return nil, nil, fmt.Errorf("%w: duplicate robot %q", ErrInvalidLayout, lr.ID)
+		}
+		add := AddRobot
+		if lr.Diagonal {
+			add = AddDiagonalRobot
+		}
+		robot, err := add(cw, lr.X, lr.Y, lr.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: robot %q at (%d, %d): %w", ErrInvalidLayout, lr.ID, lr.X, lr.Y, err)
+		}
+		impl := robot.(*robotImpl)
+		impl.mu.Lock()
+		impl.state.HasCrate = lr.HasCrate
+		impl.priority = lr.Priority
+		if lr.Battery != nil && wh.battery != nil {
+			impl.state.Battery = min(max(*lr.Battery, 0), wh.battery.Capacity)
+		}
+		impl.recordRobot()
+		impl.mu.Unlock()
+		robots[impl.id] = robot
+	}
+
+	wh.mu.Lock()
+	for name, pos := range l.Locations {
+		wh.locations[name] = pos
+	}
+	wh.mu.Unlock()
+	loaded = true
+	return cw, robots, nil
+}
+
+// Locations returns the warehouse's named cells.
+func (w *warehouseImpl) Locations() map[string]Position {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	locations := make(map[string]Position, len(w.locations))
+	for name, pos := range w.locations {
+		locations[name] = pos
+	}
+	return locations
+}
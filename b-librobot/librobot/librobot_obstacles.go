@@ -0,0 +1,57 @@
+package librobot
+
+import "log"
+
+// Static obstacles such as pillars, racking and closed aisles
+
+// AddObstacle marks the cell at x y as impassable. Robots cannot move into or be added to an obstacle cell,
+// and crates cannot be placed on one; each returns ErrObstacle.
+// The cell must be free of robots, crates and chargers.
+func (w *warehouseImpl) AddObstacle(x uint, y uint) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.inBounds(x, y) {
+		return ErrOutOfBounds
+	}
+	if w.obstaclesyx[y][x] {
+		return ErrObstacle
+	}
+	if w.gridyx[y][x] != "" {
+		return ErrPositionOccupied
+	}
+	if w.cratesyx[y][x] {
+		return ErrCrateExists
+	}
+	if w.chargersyx[y][x] {
+		return ErrChargerExists
+	}
+	w.obstaclesyx[y][x] = true
+	log.Printf("Obstacle added at (%d, %d).", x, y)
+	w.publish(Event{Type: EventObstacleAdded, X: x, Y: y})
+	w.record(journalEntry{Op: journalObstacleAdd, X: x, Y: y})
+	return nil
+}
+
+// DelObstacle clears the obstacle at x y.
+func (w *warehouseImpl) DelObstacle(x uint, y uint) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.inBounds(x, y) {
+		return ErrOutOfBounds
+	}
+	if !w.obstaclesyx[y][x] {
+		return ErrObstacleNotFound
+	}
+	w.obstaclesyx[y][x] = false
+	log.Printf("Obstacle removed from (%d, %d).", x, y)
+	w.publish(Event{Type: EventObstacleRemoved, X: x, Y: y})
+	w.record(journalEntry{Op: journalObstacleDel, X: x, Y: y})
+	return nil
+}
+
+// isObstacle reports whether the cell at x y is an obstacle. The cell must be in bounds and the warehouse lock held.
+func (w *warehouseImpl) isObstacle(x, y uint) bool {
+	return w.obstaclesyx[y][x]
+}
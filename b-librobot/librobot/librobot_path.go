@@ -0,0 +1,125 @@
+package librobot
+
+import (
+	"log"
+	"strings"
+)
+
+// Path planning for go-to-coordinate tasks
+
+// cardinalMoves are tried in this order, so equally short paths are chosen consistently
+var cardinalMoves = []rune{'N', 'E', 'S', 'W'}
+
+// diagonalMoves are also available to diagonal robots
+var diagonalMoves = []rune{MoveNorthEast, MoveSouthEast, MoveSouthWest, MoveNorthWest}
+
+// planPath finds a shortest sequence of moves from (startX, startY) to (goalX, goalY) on a width x height grid,
+// avoiding cells for which blocked returns true. Diagonal moves are used if allowDiagonal is set.
+// Every move takes one command period, so the path with the fewest moves is also the quickest.
+// It returns ErrNoPath if the goal cannot be reached.
+func planPath(startX, startY, goalX, goalY, width, height uint, allowDiagonal bool, blocked func(x, y uint) bool) ([]rune, error) {
+	moves := cardinalMoves
+	if allowDiagonal {
+		moves = append(append([]rune{}, diagonalMoves...), cardinalMoves...)
+	}
+
+	type cell struct{ x, y uint }
+	type step struct {
+		from cell
+		move rune
+	}
+	start, goal := cell{startX, startY}, cell{goalX, goalY}
+
+	// Breadth first search, recording how each cell was first reached
+	visited := map[cell]step{start: {}}
+	frontier := []cell{start}
+	for len(frontier) > 0 {
+		if _, found := visited[goal]; found {
+			break
+		}
+		current := frontier[0]
+		frontier = frontier[1:]
+		for _, move := range moves {
+			x, y := moveTarget(current.x, current.y, move)
+			next := cell{x, y}
+			if x >= width || y >= height || blocked(x, y) {
+				continue
+			}
+			if _, seen := visited[next]; seen {
+				continue
+			}
+			visited[next] = step{from: current, move: move}
+			frontier = append(frontier, next)
+		}
+	}
+	if _, ok := visited[goal]; !ok {
+		return nil, ErrNoPath
+	}
+
+	// Walk back from the goal to recover the moves
+	var path []rune
+	for c := goal; c != start; c = visited[c].from {
+		path = append(path, visited[c].move)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, nil
+}
+
+// MoveTo plans a shortest path to (x, y) and enqueues it as a task.
+// The path starts from where the robot will be once its queued tasks are done, and goes around the cells
+// currently occupied by other robots and around obstacles. Diagonal robots use diagonal moves.
+// It returns the generated command string along with the results of EnqueueTask.
+// If the target is outside the warehouse, occupied, an obstacle or unreachable, no task is queued: the task ID and
+// commands are empty and ErrOutOfBounds, ErrPositionOccupied, ErrObstacle or ErrNoPath is sent on the error channel.
+func (r *robotImpl) MoveTo(x, y uint, opts ...TaskOption) (taskID string, commands string, position chan RobotState, err chan error) {
+	cmds, planErr := r.planMoveTo(x, y)
+	if planErr != nil {
+		log.Printf("Robot %s: Could not plan path to (%d, %d): %v", r.id, x, y, planErr)
+		posChan := make(chan RobotState)
+		errChan := make(chan error, 1)
+		errChan <- planErr
+		close(errChan)
+		close(posChan)
+		return "", "", posChan, errChan
+	}
+
+	parts := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		parts[i] = string(cmd)
+	}
+	commands = strings.Join(parts, " ")
+	log.Printf("Robot %s: Planned path to (%d, %d): \"%s\"", r.id, x, y, commands)
+
+	taskID, position, err = r.EnqueueTask(commands, opts...)
+	return taskID, commands, position, err
+}
+
+// planMoveTo plans the moves to (x, y) from the robot's projected position.
+func (r *robotImpl) planMoveTo(x, y uint) ([]rune, error) {
+	r.warehouse.mu.RLock()
+	defer r.warehouse.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.warehouse.inBounds(x, y) {
+		return nil, ErrOutOfBounds
+	}
+	if occupant := r.warehouse.gridyx[y][x]; occupant != "" && occupant != r.id {
+		return nil, ErrPositionOccupied
+	}
+	if r.warehouse.isObstacle(x, y) {
+		return nil, ErrObstacle
+	}
+
+	start := r.projectedSimulator().state
+	return planPath(start.X, start.Y, x, y, r.warehouse.width, r.warehouse.height, r.isDiagonal, r.blockedCell)
+}
+
+// blockedCell reports whether the robot cannot pass through a cell, because it is an obstacle
+// or occupied by another robot. The warehouse lock must be held.
+func (r *robotImpl) blockedCell(x, y uint) bool {
+	occupant := r.warehouse.gridyx[y][x]
+	return r.warehouse.isObstacle(x, y) || occupant != "" && occupant != r.id
+}
@@ -0,0 +1,115 @@
+package librobot
+
+import (
+	"log"
+	"sync"
+)
+
+// Pausing robots, or a whole warehouse, between commands
+
+// pauseGate holds robots while it is paused
+type pauseGate struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // Closed when the gate is resumed; replaced when it is paused
+}
+
+// set pauses or resumes the gate, and reports whether it changed.
+func (g *pauseGate) set(paused bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused == paused {
+		return false
+	}
+	g.paused = paused
+	if paused {
+		g.resumed = make(chan struct{})
+	} else {
+		close(g.resumed)
+	}
+	return true
+}
+
+// state reports whether the gate is paused, and returns the channel closed when it is resumed.
+func (g *pauseGate) state() (bool, <-chan struct{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused, g.resumed
+}
+
+// Pause holds the robot in place once its current command is done. The running task and the queue are kept, and
+// tasks can still be queued and cancelled. A paused robot which is removed, or whose warehouse is closed, carries on.
+func (r *robotImpl) Pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pause.set(true) {
+		return
+	}
+	log.Printf("Robot %s: Paused.", r.id)
+	r.publishRobot(EventRobotPaused, "")
+	r.warehouse.record(journalEntry{Op: journalPause, Robot: r.id, Paused: true})
+}
+
+// Resume lets a paused robot carry on with its tasks, unless its warehouse is paused.
+func (r *robotImpl) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pause.set(false) {
+		return
+	}
+	log.Printf("Robot %s: Resumed.", r.id)
+	r.publishRobot(EventRobotResumed, "")
+	r.warehouse.record(journalEntry{Op: journalPause, Robot: r.id})
+}
+
+// Pause holds every robot in the warehouse in place once its current command is done, as for Robot.Pause.
+func (w *warehouseImpl) Pause() {
+	if !w.pause.set(true) {
+		return
+	}
+	log.Printf("Warehouse paused.")
+	w.publish(Event{Type: EventWarehousePaused})
+	w.record(journalEntry{Op: journalPause, Paused: true})
+}
+
+// Resume lets the robots carry on after the warehouse was paused. Robots paused on their own stay paused.
+func (w *warehouseImpl) Resume() {
+	if !w.pause.set(false) {
+		return
+	}
+	log.Printf("Warehouse resumed.")
+	w.publish(Event{Type: EventWarehouseResumed})
+	w.record(journalEntry{Op: journalPause})
+}
+
+// held reports whether the robot is held by its own or its warehouse's pause. If so, it returns the channel closed
+// when that pause ends, and the channel closed when the worker is told to stop.
+func (r *robotImpl) held() (bool, <-chan struct{}, chan struct{}) {
+	r.mu.Lock()
+	stop, removing := r.stopWorker, r.removing
+	r.mu.Unlock()
+	if removing {
+		return false, nil, nil
+	}
+	if paused, resumed := r.warehouse.pause.state(); paused {
+		return true, resumed, stop
+	}
+	paused, resumed := r.pause.state()
+	return paused, resumed, stop
+}
+
+// waitWhilePaused holds the robot until it is no longer paused, the task is cancelled or the worker is told to stop.
+func (r *robotImpl) waitWhilePaused(cancelCh chan struct{}) {
+	for {
+		paused, resumed, stop := r.held()
+		if !paused {
+			return
+		}
+		select {
+		case <-resumed:
+		case <-stop:
+		case <-cancelCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package librobot
+
+import (
+	"log"
+	"slices"
+)
+
+// Task priorities, and preemption of running tasks by more urgent ones
+
+// TaskPriority orders the tasks in a robot's queue; higher priorities run first.
+// Tasks of equal priority run in the order they were queued.
+type TaskPriority int
+
+// Task priority levels. Any value may be used.
+const (
+	PriorityLow    TaskPriority = -1
+	PriorityNormal TaskPriority = 0 // Default
+	PriorityHigh   TaskPriority = 1
+	PriorityUrgent TaskPriority = 2
+)
+
+// PreemptionMode identifies what a queued task does to a running task of lower priority.
+type PreemptionMode string
+
+// Preemption modes
+const (
+	PreemptNone    PreemptionMode = ""        // Wait for the running task to finish
+	PreemptSuspend PreemptionMode = "suspend" // Put the running task back in the queue, to resume after the preempting task
+	PreemptAbort   PreemptionMode = "abort"   // Cancel the running task with ErrTaskPreempted
+)
+
+// TaskOption configures a task when it is enqueued.
+type TaskOption func(*robotTask)
+
+// WithTaskPriority sets the task's priority. The default is PriorityNormal.
+func WithTaskPriority(p TaskPriority) TaskOption {
+	return func(t *robotTask) {
+		t.priority = p
+	}
+}
+
+// WithPreemption lets the task preempt a running task of lower priority. The running task is suspended or aborted
+// at the end of its current command.
+func WithPreemption(mode PreemptionMode) TaskOption {
+	return func(t *robotTask) {
+		t.preempt = mode
+	}
+}
+
+// insertPending adds a queued task to the robot's pending tasks, behind the queued tasks of the same or higher priority.
+// A task which has already started, because it was suspended or restored, goes ahead of the queued tasks of the same
+// priority instead, and a task given WithQueueFront goes ahead of every queued task. The robot's mutex must be held.
+func (r *robotImpl) insertPending(task *robotTask) {
+	started := task.executed > 0 || !task.startedAt.IsZero()
+	front := task.front
+	task.front = false
+	for i, pending := range r.pending {
+		if pending.state != TaskQueued {
+			continue // The running task stays first
+		}
+		if front || pending.priority < task.priority || (started && pending.priority == task.priority) {
+			r.pending = slices.Insert(r.pending, i, task)
+			return
+		}
+	}
+	r.pending = append(r.pending, task)
+}
+
+// requestPreemption asks the running task to give way to a newly queued task, if the new task may preempt it.
+// The robot's mutex must be held.
+func (r *robotImpl) requestPreemption(task *robotTask) {
+	if task.preempt == PreemptNone || len(r.pending) == 0 {
+		return
+	}
+	running := r.pending[0]
+	if running.state != TaskRunning || running.priority >= task.priority {
+		return
+	}
+	log.Printf("Robot %s: Task %s preempts task %s (%s)", r.id, task.id, running.id, task.preempt)
+	if running.preemptedBy != PreemptAbort {
+		running.preemptedBy = task.preempt // Aborting wins over suspending
+	}
+}
+
+// nextTask returns the queued task the robot should run next, or nil if there is none.
+func (r *robotImpl) nextTask() *robotTask {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, task := range r.pending {
+		if task.state == TaskQueued {
+			return task
+		}
+	}
+	return nil
+}
+
+// preemption returns how the running task has been preempted, if it has, and clears the request.
+func (r *robotImpl) preemption(task *robotTask) PreemptionMode {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	mode := task.preemptedBy
+	task.preemptedBy = PreemptNone
+	return mode
+}
+
+// suspendTask puts a preempted task back in the queue, to resume from its next command.
+func (r *robotImpl) suspendTask(task *robotTask) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task.state = TaskQueued
+	r.removePending(task)
+	r.insertPending(task)
+	if r.warehouse.reservations != nil {
+		r.warehouse.reservations.release(r.id)
+	}
+	log.Printf("Robot %s: Task %s suspended after %d commands.", r.id, task.id, task.executed)
+	r.publishTask(EventTaskPreempted, task)
+	r.warehouse.record(journalEntry{Op: journalSuspend, Robot: r.id, Task: task.id})
+}
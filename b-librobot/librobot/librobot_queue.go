@@ -0,0 +1,118 @@
+package librobot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+)
+
+// Inspection and management of the tasks waiting in a robot's queue
+
+// DefaultQueueCapacity is the number of queued tasks a robot accepts by default. The running task is not counted.
+const DefaultQueueCapacity = 100
+
+// WithQueueCapacity sets how many tasks may wait in each robot's queue. Once the queue is full, EnqueueTask rejects
+// new tasks with ErrQueueFull. The default is DefaultQueueCapacity; values below one are ignored.
+func WithQueueCapacity(n int) WarehouseOption {
+	return func(w *warehouseImpl) {
+		if n > 0 {
+			w.queueCapacity = n
+		}
+	}
+}
+
+// WithQueueFront puts the task at the front of the queue, ahead of every queued task whatever its priority.
+// It does not preempt the running task unless WithPreemption is also given.
+func WithQueueFront() TaskOption {
+	return func(t *robotTask) {
+		t.front = true
+	}
+}
+
+// ListQueuedTasks returns the status of the tasks waiting in the robot's queue, in the order they will run.
+// The running task is not included. A suspended task is listed where it will resume.
+func (r *robotImpl) ListQueuedTasks() []TaskStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	queued := r.queuedTasks()
+	statuses := make([]TaskStatus, len(queued))
+	for i, task := range queued {
+		statuses[i] = task.status()
+	}
+	return statuses
+}
+
+// ReorderTasks moves the given queued tasks to the front of the queue, in the given order. The other queued tasks
+// follow in their current order. Priorities are not taken into account, but are kept for tasks queued later.
+// It returns ErrTaskNotFound, and leaves the queue unchanged, if any of the tasks is not waiting in the queue.
+func (r *robotImpl) ReorderTasks(taskIDs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	queued := r.queuedTasks()
+	order := make([]*robotTask, 0, len(queued))
+	for _, taskID := range taskIDs {
+		i := slices.IndexFunc(queued, func(t *robotTask) bool { return t.id == taskID })
+		if i < 0 {
+			if slices.ContainsFunc(order, func(t *robotTask) bool { return t.id == taskID }) {
+				continue // Listed twice
+			}
+			return fmt.Errorf("error: Could not reorder task %s: %w", taskID, ErrTaskNotFound)
+		}
+		order = append(order, queued[i])
+		queued = slices.Delete(queued, i, i+1)
+	}
+	r.reorderPending(append(order, queued...))
+	log.Printf("Robot %s: Reordered queue with %d tasks.", r.id, len(order))
+	r.recordOrder()
+	return nil
+}
+
+// ClearQueue cancels every task waiting in the robot's queue, and returns their IDs. The running task carries on.
+func (r *robotImpl) ClearQueue() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var taskIDs []string
+	for _, task := range r.queuedTasks() {
+		if r.cancelTask(task.id) == nil {
+			taskIDs = append(taskIDs, task.id)
+		}
+	}
+	log.Printf("Robot %s: Cleared %d tasks from the queue.", r.id, len(taskIDs))
+	return taskIDs
+}
+
+// queuedTasks returns the robot's queued tasks in the order they will run. The robot's mutex must be held.
+func (r *robotImpl) queuedTasks() []*robotTask {
+	var queued []*robotTask
+	for _, task := range r.pending {
+		if task.state == TaskQueued {
+			queued = append(queued, task)
+		}
+	}
+	return queued
+}
+
+// reorderPending replaces the robot's queued tasks with the same tasks in the given order.
+// The running task stays first. The robot's mutex must be held.
+func (r *robotImpl) reorderPending(order []*robotTask) {
+	pending := make([]*robotTask, 0, len(r.pending))
+	for _, task := range r.pending {
+		if task.state != TaskQueued {
+			pending = append(pending, task)
+		}
+	}
+	r.pending = append(pending, order...)
+}
+
+// recordOrder records the order of the robot's queued tasks, after it was changed other than by priority.
+// The robot's mutex must be held.
+func (r *robotImpl) recordOrder() {
+	var taskIDs []string
+	for _, task := range r.queuedTasks() {
+		taskIDs = append(taskIDs, task.id)
+	}
+	r.warehouse.record(journalEntry{Op: journalReorder, Robot: r.id, Tasks: taskIDs})
+}
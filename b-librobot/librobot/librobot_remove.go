@@ -0,0 +1,133 @@
+package librobot
+
+import (
+	"context"
+	"log"
+)
+
+// Removal of robots which are being decommissioned or taken out for maintenance
+
+// RemovalPolicy configures what RemoveRobot does with the robot's pending tasks and any crate it is carrying.
+type RemovalPolicy struct {
+	Drain     bool // Let the robot finish its running and queued tasks; otherwise they are cancelled
+	DropCrate bool // Drop a carried crate where the robot stands; otherwise removal fails with ErrRobotHasCrate
+}
+
+// RemoveRobot takes the robot with the given ID out of the warehouse and stops its worker.
+// No more tasks can be queued for the robot once removal starts; EnqueueTask sends ErrRobotRemoved instead.
+// The robot's pending tasks are cancelled, or finished first if the policy drains them, and RemoveRobot returns
+// once the worker has stopped. The robot's cell and reservations are then freed.
+//
+// If the robot is carrying a crate and the policy does not drop it, or the cell already holds a crate,
+// the robot stays in the warehouse with its worker running and ErrRobotHasCrate or ErrCrateExists is returned.
+// It returns ErrRobotNotFound for an unknown robot, and ErrRobotRemoved if the robot is already being removed.
+//
+// A drained robot which is paused, or whose tasks never finish, holds RemoveRobot up; use RemoveRobotContext
+// to limit the wait.
+func RemoveRobot(w Warehouse, robotID string, policy RemovalPolicy) error {
+	return RemoveRobotContext(context.Background(), w, robotID, policy)
+}
+
+// RemoveRobotContext removes the robot as for RemoveRobot. If the context is done before a drained robot has
+// finished its tasks, the remaining tasks are cancelled and the robot is removed, and the context's error is returned.
+func RemoveRobotContext(ctx context.Context, w Warehouse, robotID string, policy RemovalPolicy) error {
+	wh, ok := w.(*warehouseImpl)
+	if !ok {
+		return ErrInvalidWarehouseType
+	}
+
+	wh.mu.RLock()
+	r, ok := wh.robots[robotID]
+	wh.mu.RUnlock()
+	if !ok {
+		return ErrRobotNotFound
+	}
+
+	r.mu.Lock()
+	if r.removing {
+		r.mu.Unlock()
+		return ErrRobotRemoved
+	}
+	if r.state.HasCrate && !policy.DropCrate {
+		r.mu.Unlock()
+		return ErrRobotHasCrate
+	}
+	r.removing = true
+	r.mu.Unlock()
+
+	if policy.Drain {
+		log.Printf("Robot %s: Removing once its tasks are done.", r.id)
+	} else {
+		log.Printf("Robot %s: Removing; cancelling %d tasks.", r.id, r.cancelPending())
+	}
+	close(r.stopWorker)
+	var drainErr error
+	select {
+	case <-r.workerDone:
+	case <-ctx.Done():
+		drainErr = ctx.Err()
+		log.Printf("Robot %s: Not drained in time: %v; cancelling %d tasks.", r.id, drainErr, r.cancelPending())
+		<-r.workerDone
+	}
+
+	wh.mu.Lock()
+	defer wh.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.state.HasCrate {
+		// The crate may have been picked up by a drained task
+		err := ErrRobotHasCrate
+		if policy.DropCrate {
+			err = r.dropCrate()
+		}
+		if err != nil {
+			log.Printf("Robot %s: Not removed: %v", r.id, err)
+			if !wh.closed.Load() {
+				r.restartWorker()
+			}
+			return err
+		}
+		log.Printf("Robot %s: Dropped crate at (%d, %d)", r.id, r.state.X, r.state.Y)
+		r.publishRobot(EventCrateDropped, "")
+		wh.record(journalEntry{Op: journalCrateAdd, X: r.state.X, Y: r.state.Y})
+	}
+
+	delete(wh.robots, r.id)
+	if wh.gridyx[r.state.Y][r.state.X] == r.id {
+		wh.gridyx[r.state.Y][r.state.X] = ""
+	}
+	if wh.reservations != nil {
+		wh.reservations.release(r.id)
+	}
+	wh.deadlocks.done(r.id)
+	log.Printf("Robot %s removed from (%d, %d).", r.id, r.state.X, r.state.Y)
+	r.publishRobot(EventRobotRemoved, "")
+	wh.record(journalEntry{Op: journalRemove, Robot: r.id})
+	return drainErr
+}
+
+// cancelPending cancels the robot's running and queued tasks, and returns how many were cancelled.
+func (r *robotImpl) cancelPending() int {
+	r.mu.Lock()
+	var cancel []string
+	for _, task := range r.pending {
+		cancel = append(cancel, task.id)
+	}
+	r.mu.Unlock()
+
+	for _, taskID := range cancel {
+		r.CancelTask(taskID) // Ignore tasks which have finished since
+	}
+	return len(cancel)
+}
+
+// restartWorker starts a new worker for a robot which is staying in the warehouse after its worker was stopped.
+// The robot's mutex must be held.
+func (r *robotImpl) restartWorker() {
+	r.removing = false
+	r.workerStarted = false
+	r.stopWorker = make(chan struct{})
+	r.workerDone = make(chan struct{})
+	go r.startWorker()
+}
@@ -0,0 +1,212 @@
+package librobot
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Space-time cell reservations for multi-robot traffic management
+
+// WithReservations enables the warehouse's cell reservation table.
+// Before each task starts, its robot reserves the cells it will occupy for each tick of the task,
+// where a tick is one CommandExecutionTime of the warehouse clock. A robot whose path conflicts with another
+// robot's reservations either yields, waiting for a later tick, or takes over the conflicting reservations,
+// according to the robots' priorities (see Robot.SetPriority).
+func WithReservations() WarehouseOption {
+	return func(w *warehouseImpl) {
+		w.reservations = newReservationTable()
+	}
+}
+
+// spaceTime identifies a cell at a tick
+type spaceTime struct {
+	x, y uint
+	tick int64
+}
+
+// reservationTable records which robot has reserved each cell at each tick
+type reservationTable struct {
+	mu       sync.Mutex
+	cells    map[spaceTime]string   // Robot ID holding each reserved cell
+	byRobot  map[string][]spaceTime // Cells reserved by each robot
+	priority map[string]int         // Priority of each robot holding reservations
+}
+
+// newReservationTable creates an empty reservation table.
+func newReservationTable() *reservationTable {
+	return &reservationTable{
+		cells:    make(map[spaceTime]string),
+		byRobot:  make(map[string][]spaceTime),
+		priority: make(map[string]int),
+	}
+}
+
+// tryReserve reserves the cells for the robot, replacing its previous reservations.
+// A conflicting reservation is taken over if its holder has a lower priority and is not standing in the cell.
+// Otherwise nothing is reserved and the ID of the robot to yield to is returned.
+// occupant returns the ID of the robot currently in a cell. It returns the IDs of robots whose reservations were taken over.
+func (t *reservationTable) tryReserve(robotID string, priority int, cells []spaceTime, occupant func(x, y uint) string) (yieldTo string, revoked []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	preempt := make(map[string]bool)
+	for _, st := range cells {
+		holder, ok := t.cells[st]
+		if !ok || holder == robotID || preempt[holder] {
+			continue
+		}
+		if t.priority[holder] >= priority || occupant(st.x, st.y) == holder {
+			return holder, nil
+		}
+		preempt[holder] = true
+	}
+
+	for holder := range preempt {
+		t.releaseLocked(holder)
+		revoked = append(revoked, holder)
+	}
+	t.releaseLocked(robotID)
+	for _, st := range cells {
+		t.cells[st] = robotID
+	}
+	t.byRobot[robotID] = cells
+	t.priority[robotID] = priority
+	return "", revoked
+}
+
+// holds reports whether the robot still holds all of the cells.
+func (t *reservationTable) holds(robotID string, cells ...spaceTime) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, st := range cells {
+		if t.cells[st] != robotID {
+			return false
+		}
+	}
+	return true
+}
+
+// release removes all of the robot's reservations.
+func (t *reservationTable) release(robotID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.releaseLocked(robotID)
+}
+
+// releaseLocked removes all of the robot's reservations. The table's mutex must be held.
+func (t *reservationTable) releaseLocked(robotID string) {
+	for _, st := range t.byRobot[robotID] {
+		if t.cells[st] == robotID {
+			delete(t.cells, st)
+		}
+	}
+	delete(t.byRobot, robotID)
+	delete(t.priority, robotID)
+}
+
+// currentTick returns the number of whole command periods since the warehouse was created.
+func (w *warehouseImpl) currentTick() int64 {
+	return int64(w.clock.Now().Sub(w.epoch) / CommandExecutionTime)
+}
+
+// SetPriority sets the robot's priority for resolving conflicting cell reservations. Higher priorities win;
+// robots start at priority 0. It only has an effect in warehouses created with WithReservations.
+func (r *robotImpl) SetPriority(priority int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.priority = priority
+}
+
+// reserveCells makes sure the robot holds reservations for the rest of the task before it executes task.cmds[i].
+// If the robot no longer holds them, because it fell behind its reservations or a higher priority robot took them over,
+// it reserves them again from the current tick, yielding a tick at a time until they are free.
+// It returns ErrTaskCancelled if the task is cancelled while yielding.
+func (r *robotImpl) reserveCells(task *robotTask, i int) error {
+	table := r.warehouse.reservations
+	if table == nil {
+		return nil
+	}
+
+	for {
+		tick := r.warehouse.currentTick()
+		cells, priority := r.reservationCells(task.cmds[i:], tick)
+		if table.holds(r.id, cells[:min(len(cells), 2)]...) {
+			return nil
+		}
+
+		yieldTo := r.tryReserveCells(cells, priority)
+		if yieldTo == "" {
+			return nil
+		}
+
+		log.Printf("Robot %s: Yielding to robot %s at tick %d", r.id, yieldTo, tick)
+		r.mu.Lock()
+		r.warehouse.publish(Event{Type: EventRobotYielded, RobotID: r.id, TaskID: task.id, X: r.state.X, Y: r.state.Y, State: r.state, BlockedBy: yieldTo})
+		r.mu.Unlock()
+
+		nextTick := r.warehouse.epoch.Add(time.Duration(tick+1) * CommandExecutionTime)
+		timer := r.warehouse.clock.NewTimer(nextTick.Sub(r.warehouse.clock.Now()))
+		select {
+		case <-timer.C():
+		case <-task.cancelCh:
+			timer.Stop()
+			return ErrTaskCancelled
+		}
+	}
+}
+
+// reserveBackOff reserves the cell a deadlocked robot backs off into with move, for the move and the command period
+// it then waits there. It reports false if the cell is reserved by a robot it must yield to. Without reservations,
+// or if the move would leave the warehouse, it reports true and the move itself is left to succeed or fail.
+func (r *robotImpl) reserveBackOff(move rune) bool {
+	if r.warehouse.reservations == nil {
+		return true
+	}
+	tick := r.warehouse.currentTick()
+	cells, priority := r.reservationCells([]rune{move}, tick)
+	if len(cells) == 0 {
+		return true
+	}
+	cells = append(cells, spaceTime{cells[1].x, cells[1].y, tick + 1})
+	return r.tryReserveCells(cells, priority) == ""
+}
+
+// tryReserveCells reserves the cells for the robot, replacing its previous reservations, and announces any
+// reservations it takes over. It returns the ID of the robot to yield to if the cells could not be reserved.
+func (r *robotImpl) tryReserveCells(cells []spaceTime, priority int) string {
+	r.warehouse.mu.RLock()
+	yieldTo, revoked := r.warehouse.reservations.tryReserve(r.id, priority, cells, func(x, y uint) string {
+		return r.warehouse.gridyx[y][x]
+	})
+	r.warehouse.mu.RUnlock()
+
+	for _, id := range revoked {
+		log.Printf("Robot %s: Took over reservations of robot %s", r.id, id)
+		r.warehouse.publish(Event{Type: EventReservationRevoked, RobotID: id, BlockedBy: r.id})
+	}
+	return yieldTo
+}
+
+// reservationCells returns the cells the robot will occupy while executing the commands from the given tick,
+// with the robot's priority. Each command occupies the cell it starts in and the cell it ends in for its tick.
+// Cells are only returned up to the first command which would leave the warehouse.
+func (r *robotImpl) reservationCells(cmds []rune, tick int64) ([]spaceTime, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	x, y := r.state.X, r.state.Y
+	cells := make([]spaceTime, 0, 2*len(cmds))
+	for k, cmd := range cmds {
+		nx, ny := x, y
+		if isMove(cmd) {
+			nx, ny = moveTarget(x, y, cmd)
+		}
+		if !r.warehouse.inBounds(nx, ny) {
+			break
+		}
+		cells = append(cells, spaceTime{x, y, tick + int64(k)}, spaceTime{nx, ny, tick + int64(k)})
+		x, y = nx, ny
+	}
+	return cells, r.priority
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"sync"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
 )
@@ -14,16 +15,25 @@ import (
 
 // robotImpl implements the Robot interfac for the simulated environment
 type robotImpl struct {
-	id             string                   // Unique identifier for a robot
-	warehouse      *warehouseImpl           // Warehouse robot
-	state          RobotState               // Store the current state of the robot; x, y, crate
-	canPickCrates  bool                     // Only robots in CrateWarehouses can pick crates
-	taskQueue      chan *robotTask          // Channel to queue robot tasks
-	cancelChannels map[string]chan struct{} // Map to store cancellation channels for each task
-	mu             *sync.Mutex              // Mutex to protect robot's internal state
-	stopWorker     chan struct{}            // Channel to signal the worker goroutine to stop
-	workerStarted  bool
-	isDiagonal     bool // Flag for diagonal movement of robot
+	id              string                   // Unique identifier for a robot
+	warehouse       *warehouseImpl           // Warehouse robot
+	state           RobotState               // Store the current state of the robot; x, y, crate
+	canPickCrates   bool                     // Only robots in CrateWarehouses can pick crates
+	wake            chan struct{}            // Wakes the worker when a task is queued; the tasks are in pending
+	cancelChannels  map[string]chan struct{} // Map to store cancellation channels for each task
+	mu              *sync.Mutex              // Mutex to protect robot's internal state
+	stopWorker      chan struct{}            // Channel to signal the worker goroutine to stop
+	workerDone      chan struct{}            // Closed when the worker goroutine has stopped
+	workerStarted   bool
+	removing        bool                  // Set once RemoveRobot starts; no more tasks are queued
+	isDiagonal      bool                  // Flag for diagonal movement of robot
+	tasks           map[string]*robotTask // Queued, running and recently finished tasks for status reporting
+	pending         []*robotTask          // Running task, then queued tasks in the order they will run
+	cancelled       []*robotTask          // Tasks cancelled while queued, whose channels the worker has yet to close
+	collisionPolicy *CollisionPolicy      // Overrides the warehouse's collision policy if set
+	priority        int                   // Priority for resolving conflicting cell reservations
+	deadlock        chan DeadlockStrategy // Tells the robot to give way in a deadlock
+	pause           pauseGate             // Holds the robot between commands while it is paused
 }
 
 // robotTask represents an individual task for the robot.
@@ -33,32 +43,143 @@ type robotTask struct {
 	positionCh chan RobotState // Channel to send periodic position updates
 	errorCh    chan error      // Channel to send task-specific errors
 	cancelCh   chan struct{}   // Channel specific to this task for cancellation
+	front      bool            // Insert the task at the front of the queue; cleared once queued
+	cmds       []rune          // Commands the robot will execute, after combining diagonal moves; replaced if rerouted
+	reroutes   int             // Number of times the task has been rerouted around a blocking robot
+	abandoned  bool            // Cancelled by Warehouse.Close; not recorded as finished in the journal
+	done       chan struct{}   // Closed when the task finishes, to wake Wait
+	priority   TaskPriority    // Position in the queue; higher priorities run first
+	preempt    PreemptionMode  // What the task does to a running task of lower priority when queued
+
+	// Progress of the task, protected by the robot's mutex
+	state       TaskState
+	executed    int
+	failedCmd   rune
+	err         error
+	queuedAt    time.Time
+	startedAt   time.Time
+	endedAt     time.Time
+	final       RobotState     // Robot state when the task finished
+	preemptedBy PreemptionMode // Set while running if a task of higher priority has preempted it
+	interrupted bool           // Cancelled by Warehouse.EmergencyStop; ends as TaskInterrupted
+}
+
+// end records the final state of the task and wakes anyone waiting for it. The robot's mutex must be held.
+func (t *robotTask) end(state TaskState, failedCmd rune, err error, now time.Time, final RobotState) {
+	t.state = state
+	t.failedCmd = failedCmd
+	t.err = err
+	t.endedAt = now
+	t.final = final
+	close(t.done)
+}
+
+// status returns a snapshot of the task's progress. The robot's mutex must be held.
+func (t *robotTask) status() TaskStatus {
+	return TaskStatus{
+		ID:               t.id,
+		State:            t.state,
+		Commands:         t.commands,
+		Priority:         t.priority,
+		TotalCommands:    len(t.cmds),
+		CommandsExecuted: t.executed,
+		FailedCommand:    t.failedCmd,
+		Err:              t.err,
+		QueuedAt:         t.queuedAt,
+		StartedAt:        t.startedAt,
+		EndedAt:          t.endedAt,
+	}
 }
 
 // EnqueueTask adds a new task to the robot's queue.
-// The tasks will be executed on the robots clock cycle in FIFO queue.
+// The tasks will be executed on the robots clock cycle in FIFO queue, ahead of tasks with a lower priority;
+// see WithTaskPriority and WithPreemption.
 // It returns the task ID and two channels for monitoring: one for position updates and one for errors.
-func (r *robotImpl) EnqueueTask(commands string) (taskID string, position chan RobotState, err chan error) {
+// The whole command string is checked first; if it contains an invalid command the task is not queued,
+// the task ID is empty and a *ParseError is sent on the error channel before both channels are closed.
+func (r *robotImpl) EnqueueTask(commands string, opts ...TaskOption) (taskID string, position chan RobotState, err chan error) {
+	task, position, err := r.enqueueTask(commands, opts)
+	if task == nil {
+		return "", position, err
+	}
+	return task.id, position, err
+}
 
-	taskID = uuid.New().String()
+// enqueueTask queues a task as for EnqueueTask, and returns the queued task, or nil if it was rejected.
+func (r *robotImpl) enqueueTask(commands string, opts []TaskOption) (*robotTask, chan RobotState, chan error) {
 	posChan := make(chan RobotState) // Unbuffered, sends immediately
 	errChan := make(chan error, 1)   // Buffered, allows error to be sent even if no one is listening immediately
 
+	cmds, parseErr := r.prepareCommands(commands)
+	if parseErr != nil {
+		log.Printf("Robot %s: Rejected task \"%s\": %v", r.id, commands, parseErr)
+		errChan <- parseErr
+		close(errChan)
+		close(posChan)
+		return nil, posChan, errChan
+	}
+
 	task := &robotTask{
-		id:         taskID,
+		id:         uuid.New().String(),
 		commands:   commands,
 		positionCh: posChan,
 		errorCh:    errChan,
 		cancelCh:   make(chan struct{}), // Unbuffered cancellation channel
+		done:       make(chan struct{}),
+		cmds:       cmds,
+		state:      TaskQueued,
+		queuedAt:   r.warehouse.clock.Now(),
+	}
+	for _, opt := range opts {
+		opt(task)
+	}
+	if err := r.queueTask(task, false); err != nil {
+		log.Printf("Robot %s: Rejected task \"%s\": %v", r.id, commands, err)
+		errChan <- err
+		close(errChan)
+		close(posChan)
+		return nil, posChan, errChan
 	}
-	r.mu.Lock()
 
-	r.cancelChannels[taskID] = task.cancelCh
-	r.taskQueue <- task // Send task to the robot's queue
+	return task, posChan, errChan
+}
 
-	r.mu.Unlock() // Unlock after changes to robot
+// queueTask adds a new task to the robot's queue and records it for status reporting.
+// A restored task goes to the back of the queue, and is accepted even if the queue is full.
+// It returns ErrRobotRemoved if the robot is being removed, and ErrQueueFull if there is no room for the task.
+func (r *robotImpl) queueTask(task *robotTask, restored bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock() // Unlock after changes to robot
 
-	return taskID, posChan, errChan
+	if r.warehouse.closed.Load() {
+		return ErrWarehouseClosed
+	}
+	if r.warehouse.incident.Load() != nil {
+		return ErrEmergencyStop
+	}
+	if r.removing {
+		return ErrRobotRemoved
+	}
+	front := task.front
+	if restored {
+		r.pending = append(r.pending, task)
+	} else {
+		if len(r.queuedTasks()) >= r.warehouse.queueCapacity {
+			return ErrQueueFull
+		}
+		r.insertPending(task)
+	}
+	r.pruneTasks()
+	r.tasks[task.id] = task
+	r.cancelChannels[task.id] = task.cancelCh
+	r.wakeWorker()
+	r.publishTask(EventTaskQueued, task)
+	r.recordTask(task)
+	if front || restored {
+		r.recordOrder() // Replaying the journal queues tasks by priority
+	}
+	r.requestPreemption(task)
+	return nil
 }
 
 // CancelTask cancels a task by ID currently enqueued or in progress.
@@ -66,10 +187,14 @@ func (r *robotImpl) CancelTask(taskID string) error {
 
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	return r.cancelTask(taskID)
+}
 
+// cancelTask cancels a task as for CancelTask. The robot's mutex must be held.
+func (r *robotImpl) cancelTask(taskID string) error {
 	cancelCh, ok := r.cancelChannels[taskID]
 	if !ok {
-		return errors.New("error: Could not cancel task: task not found")
+		return fmt.Errorf("error: Could not cancel task: %w", ErrTaskNotFound)
 	}
 
 	// Close the channel to signal cancellation. Non-blocking if already closed.
@@ -80,6 +205,18 @@ func (r *robotImpl) CancelTask(taskID string) error {
 		close(cancelCh) // Close the channel
 	}
 
+	// A queued task will not run again, so it is cancelled straight away
+	if task, ok := r.tasks[taskID]; ok && task.state == TaskQueued {
+		task.end(TaskCancelled, 0, ErrTaskCancelled, r.warehouse.clock.Now(), r.state)
+		r.removePending(task)
+		r.publishTask(EventTaskCancelled, task)
+		if !task.abandoned {
+			r.warehouse.record(journalEntry{Op: journalFinish, Robot: r.id, Task: task.id, TaskState: TaskCancelled})
+		}
+		r.cancelled = append(r.cancelled, task)
+		r.wakeWorker()
+	}
+
 	// Remove from the map regardless, as it's either cancelled or will be shortly.
 	delete(r.cancelChannels, taskID)
 	return nil
@@ -92,8 +229,81 @@ func (r *robotImpl) CurrentState() RobotState {
 	return r.state
 }
 
+// TaskStatus reports the progress of a task.
+// Finished tasks are retained for the warehouse's task retention period, after which ErrTaskNotFound is returned.
+func (r *robotImpl) TaskStatus(taskID string) (TaskStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pruneTasks()
+	task, ok := r.tasks[taskID]
+	if !ok {
+		return TaskStatus{}, ErrTaskNotFound
+	}
+	return task.status(), nil
+}
+
+// pruneTasks forgets finished tasks older than the retention period. The robot's mutex must be held.
+func (r *robotImpl) pruneTasks() {
+	cutoff := r.warehouse.clock.Now().Add(-r.warehouse.taskRetention)
+	for id, task := range r.tasks {
+		if task.state.Finished() && task.endedAt.Before(cutoff) {
+			delete(r.tasks, id)
+		}
+	}
+}
+
+// finishTask records the final state of a task.
+func (r *robotImpl) finishTask(task *robotTask, state TaskState, failedCmd rune, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task.end(state, failedCmd, err, r.warehouse.clock.Now(), r.state)
+	r.removePending(task)
+	if r.warehouse.reservations != nil {
+		r.warehouse.reservations.release(r.id)
+	}
+	if !task.abandoned || state != TaskCancelled {
+		r.warehouse.record(journalEntry{Op: journalFinish, Robot: r.id, Task: task.id, TaskState: state})
+	}
+
+	switch state {
+	case TaskCompleted:
+		r.publishTask(EventTaskCompleted, task)
+	case TaskFailed:
+		r.publishTask(EventTaskFailed, task)
+	case TaskCancelled:
+		r.publishTask(EventTaskCancelled, task)
+	case TaskInterrupted:
+		r.publishTask(EventTaskInterrupted, task)
+	}
+}
+
+// removePending removes a finished task from the robot's pending tasks. The robot's mutex must be held.
+func (r *robotImpl) removePending(task *robotTask) {
+	for i, pending := range r.pending {
+		if pending == task {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// publishTask publishes a task lifecycle event with the robot's current state. The robot's mutex must be held.
+func (r *robotImpl) publishTask(eventType EventType, task *robotTask) {
+	r.warehouse.publish(Event{
+		Type:    eventType,
+		RobotID: r.id,
+		TaskID:  task.id,
+		X:       r.state.X,
+		Y:       r.state.Y,
+		State:   r.state,
+		Err:     task.err,
+	})
+}
+
 // startWorker starts the robot's dedicated goroutine for processing tasks.
 // This should be called only once when the robot is added to the warehouse.
+// Once stopWorker is closed, the worker finishes the tasks left in the queue and stops.
 func (r *robotImpl) startWorker() {
 	r.mu.Lock()
 	if r.workerStarted {
@@ -101,55 +311,141 @@ func (r *robotImpl) startWorker() {
 		return // Worker already running
 	}
 	r.workerStarted = true
+	stop, done := r.stopWorker, r.workerDone
+	log.Printf("Robot %s worker started at (%d, %d)", r.id, r.state.X, r.state.Y)
 	r.mu.Unlock()
+	defer close(done)
 
-	log.Printf("Robot %s worker started at (%d, %d)", r.id, r.state.X, r.state.Y)
 	for {
 		select {
-		case task := <-r.taskQueue:
-			r.executeTask(task)
-			// Clean up the task's cancel channel after execution/cancellation
-			r.mu.Lock()
-			delete(r.cancelChannels, task.id)
-			r.mu.Unlock()
-		case <-r.stopWorker:
+		case <-r.wake:
+			r.runQueued()
+		case <-stop:
+			// No more tasks can be queued, so the queue is drained
+			r.runQueued()
 			log.Printf("Robot %s worker stopping.", r.id)
 			return
 		}
 	}
 }
 
-// executeTask processes a single robotTask.
+// wakeWorker tells the worker there is work to do, unless it has already been told.
+func (r *robotImpl) wakeWorker() {
+	select {
+	case r.wake <- struct{}{}:
+	default: // Already woken; the worker runs every queued task
+	}
+}
+
+// runQueued executes the queued tasks in order until there are none left.
+func (r *robotImpl) runQueued() {
+	for task := r.nextTask(); task != nil; task = r.nextTask() {
+		r.closeCancelled()
+		if paused, _, _ := r.held(); paused {
+			// Wait to start the next task, which may be a different task by then
+			r.waitWhilePaused(task.cancelCh)
+			continue
+		}
+		r.executeTask(task)
+		// Clean up the task's cancel channel after execution/cancellation, unless it was suspended
+		r.mu.Lock()
+		if task.state.Finished() {
+			delete(r.cancelChannels, task.id)
+		}
+		r.mu.Unlock()
+	}
+	r.closeCancelled()
+}
+
+// closeCancelled sends the cancellation error to the tasks cancelled while queued, and closes their channels.
+func (r *robotImpl) closeCancelled() {
+	r.mu.Lock()
+	cancelled := r.cancelled
+	r.cancelled = nil
+	r.mu.Unlock()
+	for _, task := range cancelled {
+		select {
+		case task.errorCh <- ErrTaskCancelled:
+		default:
+		}
+		close(task.errorCh)
+		close(task.positionCh)
+	}
+}
+
+// executeTask processes a single robotTask, until it finishes or is suspended.
 func (r *robotImpl) executeTask(task *robotTask) {
 	log.Printf("Robot %s: Starting task %s with commands: \"%s\"", r.id, task.id, task.commands)
-	defer close(task.positionCh) // Close position channel when task is done or aborted
-	defer close(task.errorCh)    // Close error channel when task is done or aborted
-
-	commands := parseCommands(task.commands)
 
-	// For diagonal operation, check this command and the next command
-	if r.isDiagonal {
-		commands = processCommands(commands)
+	r.mu.Lock()
+	if task.state != TaskQueued {
+		// Cancelled while waiting in the queue; its channels are closed by closeCancelled
+		r.mu.Unlock()
+		return
 	}
+	task.state = TaskRunning
+	if task.startedAt.IsZero() {
+		task.startedAt = r.warehouse.clock.Now() // Not reset when a suspended task resumes
+	}
+	r.publishTask(EventTaskStarted, task)
+	r.warehouse.record(journalEntry{Op: journalStart, Robot: r.id, Task: task.id})
+	r.mu.Unlock()
 
-	for i, cmd := range commands {
+	// Close the channels when the task is done or aborted; a suspended task keeps them until it resumes
+	suspended := false
+	defer func() {
+		if !suspended {
+			close(task.positionCh)
+			close(task.errorCh)
+		}
+	}()
+
+	// The commands may be replaced from the current index onwards if the task is rerouted.
+	// A task restored from a snapshot resumes after the commands it had executed.
+	for i := task.executed; i < len(task.cmds); i++ {
+		cmd := task.cmds[i]
+		r.waitWhilePaused(task.cancelCh)
 		select {
 		case <-task.cancelCh:
-			log.Printf("Robot %s: Task %s cancelled externally after %d commands.", r.id, task.id, i)
-			// Send a specific cancellation error if needed, or just let channels close
+			r.stopCancelled(task, i)
+			return // Abort task
+		default:
+			// Continue execution
+		}
+
+		switch r.preemption(task) {
+		case PreemptSuspend:
+			r.suspendTask(task)
+			suspended = true
+			return // Resumed by the worker once the preempting task is done
+		case PreemptAbort:
+			log.Printf("Robot %s: Task %s preempted after %d commands.", r.id, task.id, i)
+			r.finishTask(task, TaskCancelled, 0, ErrTaskPreempted)
 			select {
-			case task.errorCh <- errors.New("task cancelled"):
+			case task.errorCh <- ErrTaskPreempted:
 			default:
-				// Error channel might not be listened to, or already closed by external cancel.
 			}
 			return // Abort task
-		default:
-			// Continue execution
 		}
 
-		err := r.executeCommand(cmd)
+		err := r.reserveCells(task, i)
+		if err == nil {
+			err = r.executeTaskCommand(task, i)
+		}
+		if errors.Is(err, ErrPositionOccupied) {
+			err = r.handleCollision(task, i)
+		}
+		if err == errRerouted {
+			i-- // Start again on the first command of the detour
+			continue
+		}
+		if err == ErrTaskCancelled {
+			r.stopCancelled(task, i) // Cancelled while waiting for the way to clear
+			return                   // Abort task
+		}
 		if err != nil {
 			log.Printf("Robot %s: Task %s aborted due to error after command '%c': %v", r.id, task.id, cmd, err)
+			r.finishTask(task, TaskFailed, cmd, err)
 			select {
 			case task.errorCh <- err:
 			default:
@@ -166,15 +462,49 @@ func (r *robotImpl) executeTask(task *robotTask) {
 			// stops listening to position updates.
 		}
 
-		// Simulate real-time execution
-		time.Sleep(CommandExecutionTime)
+		// Simulate real-time execution; a cancellation ends the task straight away
+		timer := r.warehouse.clock.NewTimer(CommandExecutionTime)
+		select {
+		case <-timer.C():
+		case <-task.cancelCh:
+			timer.Stop()
+			r.stopCancelled(task, i+1)
+			return // Abort task
+		}
 	}
+	r.finishTask(task, TaskCompleted, 0, nil)
 	log.Printf("Robot %s: Task %s completed successfully.", r.id, task.id)
 }
 
-// executeCommand attempts to execute a single robot command.
+// prepareCommands parses a command string into the commands the robot will execute.
+func (r *robotImpl) prepareCommands(commands string) ([]rune, error) {
+	cmds, err := parseCommands(commands, r.isDiagonal)
+	if err != nil {
+		return nil, err
+	}
+
+	// For diagonal operation, check this command and the next command
+	if r.isDiagonal {
+		cmds = processCommands(cmds)
+	}
+	return cmds, nil
+}
+
+// executeTaskCommand executes the task's command task.cmds[i] and counts it as executed.
+// The count is updated with the robot's state, so a snapshot never sees one without the other.
+func (r *robotImpl) executeTaskCommand(task *robotTask, i int) error {
+	return r.runCommand(task.id, task.cmds[i], &task.executed)
+}
+
+// executeCommand attempts to execute a single robot command for the given task.
 // It handles movement, boundary checks, and collision detection.
-func (r *robotImpl) executeCommand(cmd rune) error {
+func (r *robotImpl) executeCommand(taskID string, cmd rune) error {
+	return r.runCommand(taskID, cmd, nil)
+}
+
+// runCommand executes a command as for executeCommand. If executed is not nil, it is incremented on success
+// while the warehouse lock and the robot's mutex are still held.
+func (r *robotImpl) runCommand(taskID string, cmd rune, executed *int) error {
 	r.warehouse.mu.Lock() // Global warehouse lock for grid manipulation
 	defer r.warehouse.mu.Unlock()
 
@@ -183,17 +513,13 @@ func (r *robotImpl) executeCommand(cmd rune) error {
 
 	currentX, currentY := r.state.X, r.state.Y
 	newX, newY := currentX, currentY
+	cost := 0 // Charge used by the command
 
 	// Add new commands here
 	switch cmd {
-	case 'N':
-		newY++
-	case 'S':
-		newY--
-	case 'E':
-		newX++
-	case 'W':
-		newX--
+	case 'N', 'S', 'E', 'W', MoveNorthEast, MoveNorthWest, MoveSouthEast, MoveSouthWest:
+		newX, newY = moveTarget(currentX, currentY, cmd)
+		cost = r.warehouse.battery.moveCost(cmd, r.state.HasCrate)
 	// Crate interactions
 	case 'G':
 		if !r.canPickCrates {
@@ -204,6 +530,7 @@ func (r *robotImpl) executeCommand(cmd rune) error {
 			return err
 		}
 		log.Printf("Robot %s: Grabbed crate at (%d, %d)", r.id, r.state.X, r.state.Y)
+		r.publishRobot(EventCrateGrabbed, taskID)
 
 	case 'D':
 		if !r.canPickCrates {
@@ -213,33 +540,43 @@ func (r *robotImpl) executeCommand(cmd rune) error {
 			return err
 		}
 		log.Printf("Robot %s: Dropped crate at (%d, %d)", r.id, r.state.X, r.state.Y)
+		r.publishRobot(EventCrateDropped, taskID)
 
-	// Phase 3 diagonal motion
-	case MoveNorthEast: // Use the defined constant
-		newY++
-		newX++
-	case MoveNorthWest:
-		newY++
-		newX--
-	case MoveSouthEast:
-		newY--
-		newX++
-	case MoveSouthWest:
-		newY--
-		newX--
+	case 'C':
+		if err := r.charge(); err != nil {
+			return err
+		}
+		log.Printf("Robot %s: Charged at (%d, %d)", r.id, r.state.X, r.state.Y)
+		r.publishRobot(EventRobotCharged, taskID)
 
 	default:
 		return fmt.Errorf("unknown command: %c", cmd)
 	}
 
-	// Boundary check; uint < 0 is always false
-	if newX > (GridSize-1) || newY > (GridSize-1) || newX < 0 || newY < 0 { // newX < 0 || newY < 0 is technically redundant due to uint, but good for clarity if types change
+	// Boundary check; moving below 0 wraps the uint around, so it is also caught here
+	if !r.warehouse.inBounds(newX, newY) {
 		return ErrOutOfBounds //errors.New("error: command would cause robot to move out of bounds")
 	}
+	if r.warehouse.isObstacle(newX, newY) {
+		return ErrObstacle
+	}
+	// Charge is checked only once the move itself is known to be valid
+	if cost > r.state.Battery {
+		return ErrBatteryDepleted
+	}
 
 	// Collision detection
 	if r.warehouse.gridyx[newY][newX] != "" && r.warehouse.gridyx[newY][newX] != r.id {
 		// Target cell is occupied by another robot
+		r.warehouse.publish(Event{
+			Type:      EventRobotBlocked,
+			RobotID:   r.id,
+			TaskID:    taskID,
+			X:         newX,
+			Y:         newY,
+			State:     r.state,
+			BlockedBy: r.warehouse.gridyx[newY][newX],
+		})
 		return ErrPositionOccupied
 	}
 
@@ -250,11 +587,55 @@ func (r *robotImpl) executeCommand(cmd rune) error {
 	// Update robot's internal state
 	r.state.X = newX
 	r.state.Y = newY
+	r.state.Battery -= cost
 
 	log.Printf("Robot %s: Moved to (%d, %d)", r.id, r.state.X, r.state.Y)
+	if newX != currentX || newY != currentY {
+		r.publishRobot(EventRobotMoved, taskID)
+	}
+	entry := journalEntry{Op: journalCommand, Robot: r.id, Task: taskID, State: r.state, Cmd: string(cmd)}
+	if executed != nil {
+		*executed++
+		entry.Executed = *executed
+	}
+	r.warehouse.record(entry)
 	return nil
 }
 
+// publishRobot publishes an event at the robot's current position. The robot's mutex must be held.
+func (r *robotImpl) publishRobot(eventType EventType, taskID string) {
+	r.warehouse.publish(Event{Type: eventType, RobotID: r.id, TaskID: taskID, X: r.state.X, Y: r.state.Y, State: r.state})
+}
+
+// moveTarget returns the cell a movement command leads to from (x, y).
+// Moving below 0 wraps the uint around, which the caller's bounds check catches.
+func moveTarget(x, y uint, cmd rune) (uint, uint) {
+	switch cmd {
+	case 'N':
+		y++
+	case 'S':
+		y--
+	case 'E':
+		x++
+	case 'W':
+		x--
+	// Phase 3 diagonal motion
+	case MoveNorthEast:
+		y++
+		x++
+	case MoveNorthWest:
+		y++
+		x--
+	case MoveSouthEast:
+		y--
+		x++
+	case MoveSouthWest:
+		y--
+		x--
+	}
+	return x, y
+}
+
 // grabCrate Picks crate at current robot position; sets RobotState.HasCrate flag
 func (r *robotImpl) grabCrate() error {
 	// Check robot carrying crate
@@ -285,16 +666,25 @@ func (r *robotImpl) dropCrate() error {
 	return nil
 }
 
-// parseCommands splits a command string into individual command runes. Spilt on whitespace
-func parseCommands(commands string) []rune {
-	// TODO error handling; if commands are not valid
+// parseCommands splits a command string into individual command runes, ignoring any whitespace.
+// Diagonal moves are only accepted for diagonal robots. The first invalid command is returned as a *ParseError.
+func parseCommands(commands string, allowDiagonal bool) ([]rune, error) {
 	var cmds []rune
+	offset := 0
 	for _, r := range commands {
-		if r != ' ' { // Ignore whitespace
+		switch {
+		case unicode.IsSpace(r):
+			// Separator
+		case r == 'N' || r == 'S' || r == 'E' || r == 'W' || r == 'G' || r == 'D' || r == 'C':
 			cmds = append(cmds, r)
+		case allowDiagonal && (r == MoveNorthEast || r == MoveNorthWest || r == MoveSouthEast || r == MoveSouthWest):
+			cmds = append(cmds, r)
+		default:
+			return nil, &ParseError{Command: r, Offset: offset, Input: commands}
 		}
+		offset++
 	}
-	return cmds
+	return cmds, nil
 }
 
 // processCommands takes a string of parsed commands and returns a modified string utilising diagonal motion
@@ -0,0 +1,149 @@
+package librobot
+
+import "fmt"
+
+// Dry-run simulation of tasks against the current state of the warehouse
+
+// Simulation describes the predicted outcome of a task, as returned by Robot.Simulate.
+type Simulation struct {
+	Start         RobotState   // State the robot will be in when the task starts, once its queued tasks are done
+	Path          []RobotState // State after each command which is predicted to succeed
+	Final         RobotState   // State the robot is predicted to finish in
+	FailedCommand rune         // First command predicted to fail, or 0
+	FailedIndex   int          // Index of the failed command among the commands the robot will execute, or -1
+}
+
+// simulator replays commands against a private copy of the robot's state and the crate layout
+type simulator struct {
+	state         RobotState
+	cratesyx      [][]bool
+	obstaclesyx   [][]bool // Shared with the warehouse, so only valid while its lock is held
+	chargersyx    [][]bool // Shared with the warehouse, as for obstaclesyx
+	battery       *BatteryModel
+	width, height uint
+	canPickCrates bool
+}
+
+// newSimulator copies the robot's state and the warehouse's crates.
+// The warehouse lock and the robot's mutex must be held.
+func (r *robotImpl) newSimulator() *simulator {
+	sim := &simulator{
+		state:         r.state,
+		cratesyx:      make([][]bool, len(r.warehouse.cratesyx)),
+		obstaclesyx:   r.warehouse.obstaclesyx,
+		chargersyx:    r.warehouse.chargersyx,
+		battery:       r.warehouse.battery,
+		width:         r.warehouse.width,
+		height:        r.warehouse.height,
+		canPickCrates: r.canPickCrates,
+	}
+	for y := range r.warehouse.cratesyx {
+		sim.cratesyx[y] = append([]bool(nil), r.warehouse.cratesyx[y]...)
+	}
+	return sim
+}
+
+// projectedSimulator returns a simulator in the state the robot and crates will be in once the robot's
+// running and queued tasks are done. The warehouse lock and the robot's mutex must be held.
+func (r *robotImpl) projectedSimulator() *simulator {
+	sim := r.newSimulator()
+	for _, task := range r.pending {
+		sim.run(task.cmds[task.executed:], nil)
+	}
+	return sim
+}
+
+// step predicts the effect of a single command, returning the error executeCommand would return.
+// Other robots are not considered, since they will have moved by the time the command runs.
+func (s *simulator) step(cmd rune) error {
+	switch cmd {
+	case 'N', 'S', 'E', 'W', MoveNorthEast, MoveNorthWest, MoveSouthEast, MoveSouthWest:
+		x, y := moveTarget(s.state.X, s.state.Y, cmd)
+		cost := s.battery.moveCost(cmd, s.state.HasCrate)
+		if x >= s.width || y >= s.height {
+			return ErrOutOfBounds
+		}
+		if s.obstaclesyx[y][x] {
+			return ErrObstacle
+		}
+		if cost > s.state.Battery {
+			return ErrBatteryDepleted
+		}
+		s.state.X, s.state.Y = x, y
+		s.state.Battery -= cost
+	case 'G':
+		if !s.canPickCrates {
+			return ErrInvalidWarehouseType
+		}
+		if s.state.HasCrate {
+			return ErrRobotHasCrate
+		}
+		if !s.cratesyx[s.state.Y][s.state.X] {
+			return ErrCrateNotFound
+		}
+		s.cratesyx[s.state.Y][s.state.X] = false
+		s.state.HasCrate = true
+	case 'D':
+		if !s.canPickCrates {
+			return ErrInvalidWarehouseType
+		}
+		if !s.state.HasCrate {
+			return ErrRobotNotCrate
+		}
+		if s.cratesyx[s.state.Y][s.state.X] {
+			return ErrCrateExists
+		}
+		s.cratesyx[s.state.Y][s.state.X] = true
+		s.state.HasCrate = false
+	case 'C':
+		if !s.chargersyx[s.state.Y][s.state.X] {
+			return ErrNotOnCharger
+		}
+		s.state.Battery = s.battery.capacity()
+	default:
+		return fmt.Errorf("unknown command: %c", cmd)
+	}
+	return nil
+}
+
+// run executes commands until one fails, returning the index of the failed command and its error, or -1 and nil.
+func (s *simulator) run(cmds []rune, path *[]RobotState) (int, error) {
+	for i, cmd := range cmds {
+		if err := s.step(cmd); err != nil {
+			return i, err
+		}
+		if path != nil {
+			*path = append(*path, s.state)
+		}
+	}
+	return -1, nil
+}
+
+// Simulate predicts the outcome of a task without queueing it or moving the robot.
+// The commands are replayed from where the robot will be once its running and queued tasks are done,
+// against the current crate layout as those tasks will leave it. A queued task predicted to fail
+// is assumed to stop at its failing command, as it would when executed.
+// It returns the predicted path and final state, and the first predicted error, if any.
+// A command string which would be rejected by EnqueueTask returns its *ParseError and an empty Simulation.
+// Other robots are not considered, so the task may still be blocked by a robot when it runs.
+func (r *robotImpl) Simulate(commands string) (Simulation, error) {
+	cmds, err := r.prepareCommands(commands)
+	if err != nil {
+		return Simulation{FailedIndex: -1}, err
+	}
+
+	r.warehouse.mu.RLock()
+	defer r.warehouse.mu.RUnlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sim := r.projectedSimulator()
+	result := Simulation{Start: sim.state, FailedIndex: -1}
+	failed, err := sim.run(cmds, &result.Path)
+	if err != nil {
+		result.FailedCommand = cmds[failed]
+		result.FailedIndex = failed
+	}
+	result.Final = sim.state
+	return result, err
+}
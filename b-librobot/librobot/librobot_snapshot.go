@@ -0,0 +1,234 @@
+package librobot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Snapshots of the full warehouse state, to checkpoint and restore running simulations
+
+// SnapshotVersion is the version of the snapshot format written by Snapshot.
+const SnapshotVersion = 1
+
+// Snapshot is the JSON form of a warehouse, as written by Warehouse.Snapshot and read by Restore.
+type Snapshot struct {
+	Version   int                 `json:"version"`
+	Width     uint                `json:"width"`
+	Height    uint                `json:"height"`
+	HasCrates bool                `json:"has_crates"` // Created with NewCrateWarehouse
+	Obstacles []Position          `json:"obstacles,omitempty"`
+	Crates    []Position          `json:"crates,omitempty"`
+	Chargers  []Position          `json:"chargers,omitempty"`
+	Locations map[string]Position `json:"locations,omitempty"`
+	Paused    bool                `json:"paused,omitempty"`   // Paused with Warehouse.Pause
+	Incident  *Incident           `json:"incident,omitempty"` // Set while stopped with Warehouse.EmergencyStop
+	Robots    []RobotSnapshot     `json:"robots"`
+}
+
+// RobotSnapshot is the state of a robot in a Snapshot.
+type RobotSnapshot struct {
+	ID              string           `json:"id"`
+	Diagonal        bool             `json:"diagonal"`
+	CanPickCrates   bool             `json:"can_pick_crates"`
+	State           RobotState       `json:"state"`
+	Priority        int              `json:"priority,omitempty"`
+	CollisionPolicy *CollisionPolicy `json:"collision_policy,omitempty"` // Set with Robot.SetCollisionPolicy
+	Paused          bool             `json:"paused,omitempty"`           // Paused with Robot.Pause
+	Tasks           []TaskSnapshot   `json:"tasks,omitempty"`            // Running task first, then queued tasks in order
+}
+
+// TaskSnapshot is a running or queued task in a Snapshot.
+type TaskSnapshot struct {
+	ID       string       `json:"id"`
+	Commands string       `json:"commands"` // Commands as given to EnqueueTask
+	Cmds     string       `json:"cmds"`     // Commands the robot executes, after combining diagonal moves and rerouting
+	Executed int          `json:"executed"` // Number of Cmds already executed; the restored task resumes from here
+	Priority TaskPriority `json:"priority,omitempty"`
+	QueuedAt time.Time    `json:"queued_at"`
+}
+
+// Snapshot returns the state of the warehouse as JSON: its grid, robots and their running and queued tasks.
+// Robots are captured between commands, so a running task resumes with its next command when restored.
+// Warehouse options, such as the clock, collision policy and battery model, are not included and are given to Restore
+// instead.
+func (w *warehouseImpl) Snapshot() ([]byte, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	snap := Snapshot{
+		Version:   SnapshotVersion,
+		Width:     w.width,
+		Height:    w.height,
+		HasCrates: w.has_crates,
+		Locations: w.locations,
+		Robots:    make([]RobotSnapshot, 0, len(w.robots)),
+	}
+	snap.Paused, _ = w.pause.state()
+	snap.Incident = w.incident.Load()
+	for y := uint(0); y < w.height; y++ {
+		for x := uint(0); x < w.width; x++ {
+			if w.obstaclesyx[y][x] {
+				snap.Obstacles = append(snap.Obstacles, Position{X: x, Y: y})
+			}
+			if w.cratesyx[y][x] {
+				snap.Crates = append(snap.Crates, Position{X: x, Y: y})
+			}
+			if w.chargersyx[y][x] {
+				snap.Chargers = append(snap.Chargers, Position{X: x, Y: y})
+			}
+		}
+	}
+	for _, r := range w.robots {
+		snap.Robots = append(snap.Robots, r.snapshot())
+	}
+	slices.SortFunc(snap.Robots, func(a, b RobotSnapshot) int { return strings.Compare(a.ID, b.ID) })
+	return json.MarshalIndent(snap, "", "  ")
+}
+
+// snapshot returns the state of the robot and its pending tasks.
+func (r *robotImpl) snapshot() RobotSnapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rs := RobotSnapshot{
+		ID:              r.id,
+		Diagonal:        r.isDiagonal,
+		CanPickCrates:   r.canPickCrates,
+		State:           r.state,
+		Priority:        r.priority,
+		CollisionPolicy: r.collisionPolicy,
+	}
+	rs.Paused, _ = r.pause.state()
+	for _, task := range r.pending {
+		select {
+		case <-task.cancelCh:
+			continue // Cancelled, but not yet stopped
+		default:
+		}
+		rs.Tasks = append(rs.Tasks, TaskSnapshot{
+			ID:       task.id,
+			Commands: task.commands,
+			Cmds:     string(task.cmds),
+			Executed: task.executed,
+			Priority: task.priority,
+			QueuedAt: task.queuedAt,
+		})
+	}
+	return rs
+}
+
+// Restore creates a running warehouse from a snapshot written by Warehouse.Snapshot, and returns it with its robots by ID.
+// The options are applied as for NewWarehouse, except that the snapshot's grid size takes precedence. Battery levels
+// are restored if a battery model is given with WithBattery.
+// Restored tasks keep their IDs and resume where they left off; their position and error channels are new
+// and not returned, so use TaskStatus or Subscribe to follow them. Errors wrap ErrInvalidSnapshot.
+func Restore(data []byte, opts ...WarehouseOption) (Warehouse, map[string]Robot, error) {
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidSnapshot, err)
+	}
+	if snap.Version != SnapshotVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSnapshot, snap.Version)
+	}
+
+	opts = append(opts[:len(opts):len(opts)], WithGridSize(snap.Width, snap.Height))
+	var w Warehouse
+	if snap.HasCrates {
+		w = NewCrateWarehouse(opts...)
+	} else {
+		w = NewWarehouse(opts...)
+	}
+	wh := w.(*warehouseImpl)
+	restored := false
+	defer func() {
+		if !restored {
+			wh.discard()
+		}
+	}()
+
+	for _, pos := range snap.Obstacles {
+		if err := wh.AddObstacle(pos.X, pos.Y); err != nil {
+			return nil, nil, fmt.Errorf("%w: obstacle at (%d, %d): %w", ErrInvalidSnapshot, pos.X, pos.Y, err)
+		}
+	}
+	for _, pos := range snap.Crates {
+		if err := wh.AddCrate(pos.X, pos.Y); err != nil {
+			return nil, nil, fmt.Errorf("%w: crate at (%d, %d): %w", ErrInvalidSnapshot, pos.X, pos.Y, err)
+		}
+	}
+	for _, pos := range snap.Chargers {
+		if err := wh.AddCharger(pos.X, pos.Y); err != nil {
+			return nil, nil, fmt.Errorf("%w: charger at (%d, %d): %w", ErrInvalidSnapshot, pos.X, pos.Y, err)
+		}
+	}
+	for name, pos := range snap.Locations {
+		if !wh.inBounds(pos.X, pos.Y) {
+			return nil, nil, fmt.Errorf("%w: location %q: %w", ErrInvalidSnapshot, name, ErrOutOfBounds)
+		}
+		wh.locations[name] = pos
+	}
+	if snap.Paused {
+		wh.Pause()
+	}
+
+	// Check every task before any robot starts working
+	tasks := make([][]*robotTask, len(snap.Robots))
+	for i, rs := range snap.Robots {
+		for _, ts := range rs.Tasks {
+			cmds, err := parseCommands(ts.Cmds, rs.Diagonal)
+			if err != nil || ts.Executed < 0 || ts.Executed > len(cmds) {
+				return nil, nil, fmt.Errorf("%w: task %s of robot %q has invalid commands", ErrInvalidSnapshot, ts.ID, rs.ID)
+			}
+			tasks[i] = append(tasks[i], restoredTask(ts.ID, ts.Commands, cmds, ts.Executed, ts.Priority, ts.QueuedAt))
+		}
+	}
+
+	robots := make(map[string]Robot, len(snap.Robots))
+	for _, rs := range snap.Robots {
+		if _, ok := robots[rs.ID]; ok || rs.ID == "" {
+			return nil, nil, fmt.Errorf("%w: duplicate or missing robot ID %q", ErrInvalidSnapshot, rs.ID)
+		}
+		add := AddRobot
+		if rs.Diagonal {
+			add = AddDiagonalRobot
+		}
+		robot, err := add(w, rs.State.X, rs.State.Y, rs.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: robot %q at (%d, %d): %w", ErrInvalidSnapshot, rs.ID, rs.State.X, rs.State.Y, err)
+		}
+		impl := robot.(*robotImpl)
+		impl.mu.Lock()
+		impl.state.HasCrate = rs.State.HasCrate
+		if wh.battery != nil {
+			impl.state.Battery = min(rs.State.Battery, wh.battery.Capacity)
+		}
+		impl.canPickCrates = rs.CanPickCrates
+		impl.priority = rs.Priority
+		impl.collisionPolicy = rs.CollisionPolicy
+		impl.recordRobot()
+		impl.mu.Unlock()
+		if rs.Paused {
+			impl.Pause()
+		}
+		robots[rs.ID] = robot
+	}
+	for i, rs := range snap.Robots {
+		impl := robots[rs.ID].(*robotImpl)
+		for _, task := range tasks[i] {
+			impl.queueTask(task, true)
+		}
+	}
+	if snap.Incident != nil {
+		// A stopped warehouse has no pending tasks, so none were queued above
+		wh.incident.Store(snap.Incident)
+		wh.record(journalEntry{Op: journalEStop, Incident: snap.Incident})
+	}
+
+	log.Printf("Warehouse restored with %d robots.", len(robots))
+	restored = true
+	return w, robots, nil
+}
@@ -4,9 +4,14 @@ package librobot
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 )
@@ -29,8 +34,8 @@ func TestNewWarehouse(t *testing.T) {
 		t.Error("warehouseImpl.mu mutex not initialized")
 	}
 	// Check grid initialization (should be all empty strings)
-	for y := uint(0); y <= GridSize; y++ {
-		for x := uint(0); x <= GridSize; x++ {
+	for y := uint(0); y < GridSize; y++ {
+		for x := uint(0); x < GridSize; x++ {
 			if whImpl.gridyx[y][x] != "" {
 				t.Errorf("grid[%d][%d] not empty on initialization, got %q", y, x, whImpl.gridyx[y][x])
 			}
@@ -145,7 +150,9 @@ func TestRobot_EnqueueTask(t *testing.T) {
 // TestRobot_CancelTask tests cancelling a task conditions such as in progress
 func TestRobot_CancelTask(t *testing.T) {
 	t.Log("Starting TestRobot_CancelTask")
-	test_warehouse := NewWarehouse()
+	// Step the robot with a fake clock so the cancellation lands deterministically
+	clock := newTestClock()
+	test_warehouse := NewWarehouse(WithClock(clock))
 	r, err := AddRobot(test_warehouse, 0, 0, "R1")
 	if err != nil {
 		t.Fatalf("Failed to add robot: %v", err)
@@ -157,42 +164,18 @@ func TestRobot_CancelTask(t *testing.T) {
 	longTaskCommands := "NNNNNNNNNN" // 10 commands
 	taskID1, posCh1, errCh1 := r.EnqueueTask(longTaskCommands)
 
-	// Wait for a few commands to execute, then cancel
-	//time.Sleep(2 * CommandExecutionTime) // Let 2 commands run
-
-	// Better, more deterministic
-	// Wait for a few commands to execute deterministically
-	const updatesToWait = 2
-	var updatesReceived sync.WaitGroup
-	updatesReceived.Add(updatesToWait)
-
-	go func() {
-		for range posCh1 {
-			updatesReceived.Done()
-		}
-	}()
-
-	// Wait until we know at least 2 commands have finished.
-	// We'll use a timeout here just in case something is wrong with the task execution.
-	waitTimeout := time.After(time.Duration(updatesToWait+1) * CommandExecutionTime)
-	done := make(chan struct{})
-	go func() {
-		updatesReceived.Wait()
-		close(done)
-	}()
-
-	select {
-	case <-done:
-		// We've received the expected number of updates, now we can cancel.
-	case <-waitTimeout:
-		t.Fatal("Timeout waiting for position updates before cancellation")
-	}
+	// Wait for 2 commands to execute, then cancel
+	clock.BlockUntil(1) // First command done, robot waiting for the command period
+	clock.Advance(CommandExecutionTime)
+	clock.BlockUntil(1) // Second command done
 
 	// Cancel the task
 	err = r.CancelTask(taskID1)
 	if err != nil {
 		t.Fatalf("Failed to cancel task 1: %v", err)
 	}
+	// Let the robot reach the next command, where it sees the cancellation
+	clock.Advance(CommandExecutionTime)
 
 	// Verify task 1 aborts and returns cancellation error
 	select {
@@ -613,34 +596,71 @@ func TestInvalidCommands(t *testing.T) {
 
 	initialState := r.CurrentState()
 
-	taskID, posCh, errCh := r.EnqueueTask("NX") // N then an invalid command 'X'
-	select {
-	case state := <-posCh:
-		// First command 'N' should succeed, robot moves to (5,6)
-		if state.X != 5 || state.Y != 6 {
-			t.Errorf("Expected (5,6) after 'N', got (%d,%d) on task %v", state.X, state.Y, taskID)
+	tests := []struct {
+		commands string
+		command  rune
+		offset   int
+	}{
+		{"NX", 'X', 1},    // N then an invalid command 'X'
+		{"N X E", 'X', 2}, // Offsets count whitespace
+		{"N n", 'n', 2},   // Commands are capital letters
+		{"N\t↗", '↗', 2},  // Diagonal moves are only accepted by diagonal robots
+		{"é N ?", 'é', 0}, // Offsets count characters, not bytes
+		{"N N N N ?", '?', 8},
+	}
+	for _, tt := range tests {
+		taskID, posCh, errCh := r.EnqueueTask(tt.commands)
+		if taskID != "" {
+			t.Errorf("%q: expected no task ID for rejected task, got %s", tt.commands, taskID)
 		}
-	case <-time.After(2 * CommandExecutionTime):
-		t.Fatal("Timeout waiting for first valid command")
-	}
 
-	select {
-	case taskErr := <-errCh:
-		expectedErrStr := "unknown command: X"
-		if taskErr == nil || taskErr.Error() != expectedErrStr {
-			t.Errorf("Expected error '%s', got '%v'", expectedErrStr, taskErr)
+		// The task is rejected before the robot moves
+		taskErr := <-errCh
+		var parseErr *ParseError
+		if !errors.As(taskErr, &parseErr) || !errors.Is(taskErr, ErrInvalidCommand) {
+			t.Fatalf("%q: expected a ParseError, got %v", tt.commands, taskErr)
 		}
-	case <-time.After(2 * CommandExecutionTime): // Wait for error from second command
-		t.Fatal("Timeout waiting for invalid command error")
+		if parseErr.Command != tt.command || parseErr.Offset != tt.offset {
+			t.Errorf("%q: expected %q at offset %d, got %q at offset %d", tt.commands, tt.command, tt.offset, parseErr.Command, parseErr.Offset)
+		}
+		if _, ok := <-posCh; ok {
+			t.Errorf("%q: expected position channel to be closed", tt.commands)
+		}
+		if _, ok := <-errCh; ok {
+			t.Errorf("%q: expected error channel to be closed", tt.commands)
+		}
+	}
+
+	if finalState := r.CurrentState(); finalState != initialState {
+		t.Errorf("Robot should not move for invalid commands. Expected %+v, got %+v", initialState, finalState)
 	}
+}
+
+// TestWhitespaceCommands checks any Unicode whitespace separates commands
+func TestWhitespaceCommands(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock))
+	r, _ := AddRobot(w, 0, 0, "R1")
 
-	// Robot should be at (5,6) (after 'N' and before 'X' aborted the task)
-	finalState := r.CurrentState()
-	if finalState.X != 5 || finalState.Y != 6 {
-		t.Errorf("Robot state incorrect after invalid command abort. Expected (5,6), got (%d,%d)", finalState.X, finalState.Y)
+	taskID, _, errCh := r.EnqueueTask("N\tE\nN\u00a0E\u2003N")
+	if taskID == "" {
+		t.Fatal("Expected task to be accepted")
+	}
+	for range 5 {
+		clock.BlockUntil(1)
+		clock.Advance(CommandExecutionTime)
+	}
+	for err := range errCh {
+		t.Errorf("Unexpected error: %v", err)
 	}
-	if finalState == initialState {
-		t.Error("Robot state should have changed after first valid command")
+	if state := r.CurrentState(); state.X != 2 || state.Y != 3 {
+		t.Errorf("Expected (2,3), got (%d,%d)", state.X, state.Y)
+	}
+
+	// Diagonal robots accept diagonal moves directly
+	d, _ := AddDiagonalRobot(w, 5, 5, "D1")
+	if taskID, _, _ := d.EnqueueTask("↗ N"); taskID == "" {
+		t.Error("Expected diagonal robot to accept a diagonal move")
 	}
 }
 
@@ -885,3 +905,1766 @@ func TestRender_PrintsCorrectWarehouseView(t *testing.T) {
 		t.Errorf("Expected crate to render as [C], got:\n%s", output)
 	}
 }
+
+// TestRender_ShortRobotID checks robots with one character IDs are drawn without panicking
+func TestRender_ShortRobotID(t *testing.T) {
+	cw := NewCrateWarehouse(WithClock(newTestClock()))
+	if _, err := AddRobot(cw, 1, 1, "A"); err != nil {
+		t.Fatalf("Error adding robot: %v", err)
+	}
+
+	var buf bytes.Buffer
+	stdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	Render(cw, nil)
+	w.Close()
+	os.Stdout = stdout
+	buf.ReadFrom(r)
+
+	if !strings.Contains(buf.String(), " - A - ") {
+		t.Errorf("Expected robot A to be drawn, got:\n%s", buf.String())
+	}
+}
+
+// TestWarehouse_GridSize checks bounds and rendering honour a non-square warehouse size
+func TestWarehouse_GridSize(t *testing.T) {
+	clock := newTestClock()
+	cw := NewCrateWarehouse(WithGridSize(20, 5), WithClock(clock))
+
+	if width, height := cw.Size(); width != 20 || height != 5 {
+		t.Fatalf("Expected size 20x5, got %dx%d", width, height)
+	}
+	if width, height := NewWarehouse().Size(); width != GridSize || height != GridSize {
+		t.Errorf("Expected default size %dx%d, got %dx%d", GridSize, GridSize, width, height)
+	}
+
+	// Robots and crates beyond the default grid but inside this warehouse
+	r, err := AddRobot(cw, 18, 4, "R1")
+	if err != nil {
+		t.Fatalf("Failed to add robot inside the grid: %v", err)
+	}
+	if _, err := AddRobot(cw, 0, 5, "R2"); err == nil {
+		t.Error("Expected error adding robot above the grid")
+	}
+	if _, err := AddDiagonalRobot(cw, 20, 0, "R3"); err != ErrOutOfBounds {
+		t.Errorf("Expected %v adding robot east of the grid, got %v", ErrOutOfBounds, err)
+	}
+	if err := cw.AddCrate(19, 0); err != nil {
+		t.Errorf("Failed to add crate inside the grid: %v", err)
+	}
+	if err := cw.AddCrate(5, 5); err != ErrCrateOutOfBounds {
+		t.Errorf("Expected %v adding crate above the grid, got %v", ErrCrateOutOfBounds, err)
+	}
+	if err := cw.DelCrate(20, 0); err != ErrCrateOutOfBounds {
+		t.Errorf("Expected %v deleting crate east of the grid, got %v", ErrCrateOutOfBounds, err)
+	}
+
+	// Moving east reaches the edge, then leaves the grid
+	_, _, errCh := r.EnqueueTask("E E")
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	select {
+	case err := <-errCh:
+		if err != ErrOutOfBounds {
+			t.Errorf("Expected %v, got %v", ErrOutOfBounds, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for out of bounds error")
+	}
+	if state := r.CurrentState(); state.X != 19 || state.Y != 4 {
+		t.Errorf("Expected robot at (19,4), got (%d,%d)", state.X, state.Y)
+	}
+
+	// Render draws every row and column
+	var buf bytes.Buffer
+	stdout := os.Stdout
+	pr, pw, _ := os.Pipe()
+	os.Stdout = pw
+	Render(cw, nil)
+	pw.Close()
+	os.Stdout = stdout
+	buf.ReadFrom(pr)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 7 { // Header, 5 rows, footer
+		t.Fatalf("Expected 7 lines of output, got %d:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasSuffix(lines[1], "R1") {
+		t.Errorf("Expected robot at the end of the top row, got %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[5], "[C]") || len(lines[5]) != 60 {
+		t.Errorf("Expected 20 cells ending in a crate on the bottom row, got %q", lines[5])
+	}
+}
+
+// TestRobot_TaskStatus checks task progress is reported through the task lifecycle and retained after completion
+func TestRobot_TaskStatus(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock), WithTaskRetention(time.Minute))
+	r, err := AddRobot(w, 0, 0, "R1")
+	if err != nil {
+		t.Fatalf("Failed to add robot: %v", err)
+	}
+	start := clock.Now()
+
+	taskID1, _, errCh1 := r.EnqueueTask("N E")
+	taskID2, _, errCh2 := r.EnqueueTask("W W W")
+	taskID3, _, _ := r.EnqueueTask("N")
+
+	// Task 1 has run its first command
+	clock.BlockUntil(1)
+	status, err := r.TaskStatus(taskID1)
+	if err != nil {
+		t.Fatalf("TaskStatus failed: %v", err)
+	}
+	if status.State != TaskRunning || status.CommandsExecuted != 1 || status.TotalCommands != 2 {
+		t.Errorf("Expected running task with 1 of 2 commands executed, got %+v", status)
+	}
+	if !status.QueuedAt.Equal(start) || !status.StartedAt.Equal(start) || !status.EndedAt.IsZero() {
+		t.Errorf("Unexpected timestamps for running task: %+v", status)
+	}
+	if status, _ := r.TaskStatus(taskID2); status.State != TaskQueued || !status.StartedAt.IsZero() {
+		t.Errorf("Expected task 2 queued, got %+v", status)
+	}
+
+	// Cancelling a queued task takes effect immediately
+	if err := r.CancelTask(taskID3); err != nil {
+		t.Fatalf("Failed to cancel task 3: %v", err)
+	}
+	if status, _ := r.TaskStatus(taskID3); status.State != TaskCancelled || status.Err != ErrTaskCancelled {
+		t.Errorf("Expected task 3 cancelled, got %+v", status)
+	}
+
+	// Task 1 completes at (1,1), then task 2 fails moving west of the warehouse
+	clock.Advance(CommandExecutionTime)
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	for range errCh1 {
+	}
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	for range errCh2 {
+	}
+
+	status, _ = r.TaskStatus(taskID1)
+	if status.State != TaskCompleted || status.CommandsExecuted != 2 || status.Err != nil {
+		t.Errorf("Expected task 1 completed, got %+v", status)
+	}
+	if !status.EndedAt.Equal(start.Add(2 * CommandExecutionTime)) {
+		t.Errorf("Expected task 1 to end at %v, got %v", start.Add(2*CommandExecutionTime), status.EndedAt)
+	}
+
+	status, _ = r.TaskStatus(taskID2)
+	if status.State != TaskFailed || status.FailedCommand != 'W' || status.Err != ErrOutOfBounds || status.CommandsExecuted != 1 {
+		t.Errorf("Expected task 2 failed on second 'W', got %+v", status)
+	}
+	if !status.State.Finished() || TaskRunning.Finished() {
+		t.Error("Unexpected result from TaskState.Finished")
+	}
+
+	// Finished tasks are forgotten after the retention period
+	clock.Advance(2 * time.Minute)
+	if _, err := r.TaskStatus(taskID1); err != ErrTaskNotFound {
+		t.Errorf("Expected %v after retention period, got %v", ErrTaskNotFound, err)
+	}
+	if _, err := r.TaskStatus("unknown"); err != ErrTaskNotFound {
+		t.Errorf("Expected %v for unknown task, got %v", ErrTaskNotFound, err)
+	}
+}
+
+// TestWarehouse_Subscribe checks robot, task and crate events are published in order with sequence numbers and clock times
+func TestWarehouse_Subscribe(t *testing.T) {
+	clock := newTestClock()
+	w := NewCrateWarehouse(WithClock(clock))
+	events, cancel := w.Subscribe()
+	defer cancel()
+
+	r1, _ := AddRobot(w, 0, 0, "R1")
+	AddRobot(w, 1, 1, "R2")
+	w.AddCrate(0, 1)
+
+	// R1 grabs the crate, then is blocked by R2
+	taskID, _, errCh := r1.EnqueueTask("N G E")
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	for range errCh {
+	}
+
+	w.AddCrate(5, 5)
+	w.DelCrate(5, 5)
+
+	expected := []Event{
+		{Type: EventRobotAdded, RobotID: "R1"},
+		{Type: EventRobotAdded, RobotID: "R2", X: 1, Y: 1},
+		{Type: EventCrateAdded, X: 0, Y: 1},
+		{Type: EventTaskQueued, RobotID: "R1", TaskID: taskID},
+		{Type: EventTaskStarted, RobotID: "R1", TaskID: taskID},
+		{Type: EventRobotMoved, RobotID: "R1", TaskID: taskID, Y: 1},
+		{Type: EventCrateGrabbed, RobotID: "R1", TaskID: taskID, Y: 1},
+		{Type: EventRobotBlocked, RobotID: "R1", TaskID: taskID, X: 1, Y: 1, BlockedBy: "R2"},
+		{Type: EventTaskFailed, RobotID: "R1", TaskID: taskID, Y: 1, State: RobotState{Y: 1, HasCrate: true}, Err: ErrPositionOccupied},
+		{Type: EventCrateAdded, X: 5, Y: 5},
+		{Type: EventCrateRemoved, X: 5, Y: 5},
+	}
+	start := clock.Now().Add(-2 * CommandExecutionTime)
+	for i, want := range expected {
+		var ev Event
+		select {
+		case ev = <-events:
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for event %d (%s)", i, want.Type)
+		}
+		if ev.Seq != uint64(i+1) {
+			t.Errorf("Event %d: expected sequence %d, got %d", i, i+1, ev.Seq)
+		}
+		if ev.Type != want.Type || ev.RobotID != want.RobotID || ev.TaskID != want.TaskID ||
+			ev.X != want.X || ev.Y != want.Y || ev.BlockedBy != want.BlockedBy || ev.Err != want.Err ||
+			(want.State != RobotState{} && ev.State != want.State) {
+			t.Errorf("Event %d: expected %+v, got %+v", i, want, ev)
+		}
+		if ev.Time.Before(start) {
+			t.Errorf("Event %d: time %v is before the simulation started", i, ev.Time)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("Unexpected event %+v", ev)
+	default:
+	}
+}
+
+// TestWarehouse_SubscribeFiltered checks subscriptions only receive the requested event types and close when cancelled
+func TestWarehouse_SubscribeFiltered(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock))
+	events, cancel := w.Subscribe(EventTaskCompleted, EventTaskCancelled)
+	r, _ := AddRobot(w, 0, 0, "R1")
+
+	taskID1, _, errCh := r.EnqueueTask("N")
+	taskID2, _, _ := r.EnqueueTask("E")
+	r.CancelTask(taskID2)
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	for range errCh {
+	}
+
+	// Task 2 was cancelled before task 1 finished
+	for _, want := range []struct {
+		eventType EventType
+		taskID    string
+	}{{EventTaskCancelled, taskID2}, {EventTaskCompleted, taskID1}} {
+		select {
+		case ev := <-events:
+			if ev.Type != want.eventType || ev.TaskID != want.taskID {
+				t.Errorf("Expected %s for task %s, got %s for task %s", want.eventType, want.taskID, ev.Type, ev.TaskID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for %s", want.eventType)
+		}
+	}
+
+	cancel()
+	cancel() // Safe to call twice
+	if _, ok := <-events; ok {
+		t.Error("Expected events channel to be closed after cancel")
+	}
+}
+
+// TestRobot_Simulate checks tasks are simulated from the robot's projected position and crate layout without moving the robot
+func TestRobot_Simulate(t *testing.T) {
+	clock := newTestClock()
+	cw := NewCrateWarehouse(WithClock(clock))
+	r, err := AddRobot(cw, 0, 0, "R1")
+	if err != nil {
+		t.Fatalf("Failed to add robot: %v", err)
+	}
+	cw.AddCrate(0, 1)
+	cw.AddCrate(1, 1)
+
+	// The robot is part way through a task which will grab the crate at (0,1) and carry it to (0,2)
+	_, _, errCh := r.EnqueueTask("N G N")
+	clock.BlockUntil(1)
+
+	sim, err := r.Simulate("E D S")
+	if err != nil {
+		t.Fatalf("Unexpected predicted error: %v", err)
+	}
+	if sim.Start != (RobotState{X: 0, Y: 2, HasCrate: true}) {
+		t.Errorf("Expected simulation to start at (0,2) with a crate, got %+v", sim.Start)
+	}
+	expectedPath := []RobotState{{X: 1, Y: 2, HasCrate: true}, {X: 1, Y: 2}, {X: 1, Y: 1}}
+	if len(sim.Path) != len(expectedPath) {
+		t.Fatalf("Expected path %v, got %v", expectedPath, sim.Path)
+	}
+	for i := range expectedPath {
+		if sim.Path[i] != expectedPath[i] {
+			t.Errorf("Path step %d: expected %+v, got %+v", i, expectedPath[i], sim.Path[i])
+		}
+	}
+	if sim.Final != expectedPath[2] || sim.FailedCommand != 0 || sim.FailedIndex != -1 {
+		t.Errorf("Unexpected simulation result %+v", sim)
+	}
+
+	// The crate at (0,1) will have been picked up by the queued task, and the second move leaves the grid
+	for _, tc := range []struct {
+		commands string
+		err      error
+		failed   rune
+		index    int
+		final    RobotState
+	}{
+		{"S D S G", ErrCrateNotFound, 'G', 3, RobotState{X: 0, Y: 0}},
+		{"E S G", ErrRobotHasCrate, 'G', 2, RobotState{X: 1, Y: 1, HasCrate: true}},
+		{"S D E D", ErrRobotNotCrate, 'D', 3, RobotState{X: 1, Y: 1}},
+		{"W", ErrOutOfBounds, 'W', 0, RobotState{X: 0, Y: 2, HasCrate: true}},
+	} {
+		sim, err := r.Simulate(tc.commands)
+		if err != tc.err || sim.FailedCommand != tc.failed || sim.FailedIndex != tc.index || sim.Final != tc.final {
+			t.Errorf("Simulate(%q): expected %v on '%c' at %d ending at %+v, got %v and %+v",
+				tc.commands, tc.err, tc.failed, tc.index, tc.final, err, sim)
+		}
+	}
+
+	var parseErr *ParseError
+	if _, err := r.Simulate("N X"); !errors.As(err, &parseErr) {
+		t.Errorf("Expected *ParseError for invalid command, got %v", err)
+	}
+
+	// Simulating does not change the robot or the warehouse
+	if state := r.CurrentState(); state != (RobotState{X: 0, Y: 1}) {
+		t.Errorf("Expected robot to remain at (0,1), got %+v", state)
+	}
+	if !cw.(*warehouseImpl).cratesyx[1][0] {
+		t.Error("Expected crate at (0,1) to remain in the warehouse")
+	}
+
+	// Once the robot is idle, tasks are simulated from its current position
+	clock.Advance(CommandExecutionTime)
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	for range errCh {
+	}
+	if sim, _ := r.Simulate(""); sim.Start != (RobotState{X: 0, Y: 2, HasCrate: true}) || len(sim.Path) != 0 {
+		t.Errorf("Expected empty simulation from (0,2), got %+v", sim)
+	}
+}
+
+// TestRobot_MoveTo checks paths are planned around other robots and enqueued as tasks
+func TestRobot_MoveTo(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock))
+	r, err := AddRobot(w, 0, 0, "R1")
+	if err != nil {
+		t.Fatalf("Failed to add robot: %v", err)
+	}
+	d, err := AddDiagonalRobot(w, 0, 5, "D1")
+	if err != nil {
+		t.Fatalf("Failed to add diagonal robot: %v", err)
+	}
+	// A wall of robots at x=1 from y=0 to y=2
+	for y := uint(0); y < 3; y++ {
+		if _, err := AddRobot(w, 1, y, ""); err != nil {
+			t.Fatalf("Failed to add robot: %v", err)
+		}
+	}
+
+	taskID, commands, _, errCh := r.MoveTo(2, 0)
+	if taskID == "" {
+		t.Fatalf("MoveTo failed: %v", <-errCh)
+	}
+	if commands != "N N N E E S S S" {
+		t.Errorf("Expected path around the wall, got %q", commands)
+	}
+	if status, _ := r.TaskStatus(taskID); status.Commands != commands {
+		t.Errorf("Expected task to run the planned commands, got %q", status.Commands)
+	}
+
+	// Diagonal robots pass the end of the wall diagonally, in 4 moves rather than 6
+	_, commands, _, _ = d.MoveTo(2, 1)
+	if commands != "↘ ↘ ↘ ↙" {
+		t.Errorf("Expected diagonal path past the wall, got %q", commands)
+	}
+	if sim, _ := d.Simulate(""); sim.Start.X != 2 || sim.Start.Y != 1 {
+		t.Errorf("Expected planned path to end at (2,1), got %+v", sim.Start)
+	}
+
+	// Planning starts from where the queued tasks leave the robot
+	_, commands, _, _ = r.MoveTo(2, 2)
+	if commands != "N N" {
+		t.Errorf("Expected path from (2,0), got %q", commands)
+	}
+
+	for _, tc := range []struct {
+		x, y uint
+		err  error
+	}{
+		{GridSize, 0, ErrOutOfBounds},
+		{1, 1, ErrPositionOccupied},
+	} {
+		taskID, commands, _, errCh := r.MoveTo(tc.x, tc.y)
+		if taskID != "" || commands != "" {
+			t.Errorf("MoveTo(%d, %d): expected no task, got %q %q", tc.x, tc.y, taskID, commands)
+		}
+		if err := <-errCh; err != tc.err {
+			t.Errorf("MoveTo(%d, %d): expected %v, got %v", tc.x, tc.y, tc.err, err)
+		}
+	}
+}
+
+// TestPlanPath checks unreachable targets are reported
+func TestPlanPath(t *testing.T) {
+	// The target is boxed in
+	blocked := func(x, y uint) bool {
+		return (x == 3 || x == 5 || y == 3 || y == 5) && x >= 3 && x <= 5 && y >= 3 && y <= 5
+	}
+	if _, err := planPath(0, 0, 4, 4, GridSize, GridSize, true, blocked); err != ErrNoPath {
+		t.Errorf("Expected %v, got %v", ErrNoPath, err)
+	}
+	path, err := planPath(0, 0, 0, 0, GridSize, GridSize, false, blocked)
+	if err != nil || len(path) != 0 {
+		t.Errorf("Expected empty path to the start, got %q %v", string(path), err)
+	}
+}
+
+// TestRobot_CollisionPolicy checks blocked robots wait, retry or reroute according to their collision policy
+func TestRobot_CollisionPolicy(t *testing.T) {
+	// setup creates R1 at (0,0) blocked to the east by R2 at (1,0)
+	setup := func(opts ...WarehouseOption) (*FakeClock, Warehouse, Robot, Robot, <-chan Event) {
+		clock := newTestClock()
+		w := NewWarehouse(append([]WarehouseOption{WithClock(clock)}, opts...)...)
+		events, cancel := w.Subscribe(EventRobotWaiting, EventRobotRerouted)
+		t.Cleanup(cancel)
+		r1, _ := AddRobot(w, 0, 0, "R1")
+		r2, _ := AddRobot(w, 1, 0, "R2")
+		return clock, w, r1, r2, events
+	}
+	finalErr := func(errCh chan error) error {
+		var err error
+		for e := range errCh {
+			err = e
+		}
+		return err
+	}
+
+	t.Run("wait until clear", func(t *testing.T) {
+		clock, _, r1, r2, events := setup(WithCollisionPolicy(WaitOnCollision(2 * time.Second)))
+		_, _, errCh := r1.EnqueueTask("E")
+		clock.BlockUntil(1) // R1 waiting for the cell
+		r2.EnqueueTask("N")
+		clock.BlockUntil(2) // R2 has moved out of the way
+		clock.Advance(CollisionRetryInterval)
+		clock.BlockUntil(2) // R1 has moved in
+		clock.Advance(CommandExecutionTime)
+		if err := finalErr(errCh); err != nil {
+			t.Fatalf("Expected task to complete after waiting, got %v", err)
+		}
+		if state := r1.CurrentState(); state.X != 1 || state.Y != 0 {
+			t.Errorf("Expected R1 at (1,0), got (%d,%d)", state.X, state.Y)
+		}
+		if ev := <-events; ev.Type != EventRobotWaiting || ev.RobotID != "R1" || ev.BlockedBy != "R2" || ev.X != 1 {
+			t.Errorf("Unexpected event %+v", ev)
+		}
+	})
+
+	t.Run("wait times out", func(t *testing.T) {
+		clock, _, r1, _, _ := setup(WithCollisionPolicy(WaitOnCollision(2 * CollisionRetryInterval)))
+		taskID, _, errCh := r1.EnqueueTask("E")
+		clock.BlockUntil(1)
+		clock.Advance(CollisionRetryInterval)
+		clock.BlockUntil(1)
+		clock.Advance(CollisionRetryInterval)
+		if err := finalErr(errCh); err != ErrPositionOccupied {
+			t.Errorf("Expected %v after timeout, got %v", ErrPositionOccupied, err)
+		}
+		if status, _ := r1.TaskStatus(taskID); status.State != TaskFailed || !status.EndedAt.Equal(clock.Now()) {
+			t.Errorf("Expected task to fail after the timeout, got %+v", status)
+		}
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		clock, _, r1, _, events := setup()
+		r1.SetCollisionPolicy(RetryOnCollision(2))
+		_, _, errCh := r1.EnqueueTask("E")
+		clock.BlockUntil(1)
+		clock.Advance(CollisionRetryInterval)
+		clock.BlockUntil(1)
+		clock.Advance(CollisionRetryInterval)
+		if err := finalErr(errCh); err != ErrPositionOccupied {
+			t.Errorf("Expected %v after retries, got %v", ErrPositionOccupied, err)
+		}
+		if len(events) != 2 {
+			t.Errorf("Expected 2 waiting events, got %d", len(events))
+		}
+	})
+
+	t.Run("cancel while waiting", func(t *testing.T) {
+		clock, _, r1, _, _ := setup(WithCollisionPolicy(WaitOnCollision(time.Hour)))
+		taskID, _, errCh := r1.EnqueueTask("E")
+		clock.BlockUntil(1)
+		r1.CancelTask(taskID)
+		if err := finalErr(errCh); err != ErrTaskCancelled {
+			t.Errorf("Expected %v, got %v", ErrTaskCancelled, err)
+		}
+	})
+
+	t.Run("reroute", func(t *testing.T) {
+		clock, _, r1, _, events := setup(WithCollisionPolicy(WaitOnCollision(time.Hour)))
+		r1.SetCollisionPolicy(RerouteOnCollision(1)) // Overrides the warehouse policy
+		taskID, _, errCh := r1.EnqueueTask("E E N")
+		for range 3 {
+			clock.BlockUntil(1)
+			clock.Advance(CommandExecutionTime)
+		}
+		if err := finalErr(errCh); err != nil {
+			t.Fatalf("Expected rerouted task to complete, got %v", err)
+		}
+		if state := r1.CurrentState(); state.X != 2 || state.Y != 1 {
+			t.Errorf("Expected R1 at (2,1), got (%d,%d)", state.X, state.Y)
+		}
+		if status, _ := r1.TaskStatus(taskID); status.TotalCommands != 3 || status.CommandsExecuted != 3 {
+			t.Errorf("Expected 3 commands on the detour, got %+v", status)
+		}
+		if ev := <-events; ev.Type != EventRobotRerouted || ev.X != 2 || ev.Y != 1 {
+			t.Errorf("Unexpected event %+v", ev)
+		}
+	})
+
+	t.Run("abort by default", func(t *testing.T) {
+		_, _, r1, _, events := setup()
+		_, _, errCh := r1.EnqueueTask("E")
+		if err := finalErr(errCh); err != ErrPositionOccupied {
+			t.Errorf("Expected %v, got %v", ErrPositionOccupied, err)
+		}
+		if len(events) != 0 {
+			t.Errorf("Expected no waiting or reroute events, got %d", len(events))
+		}
+	})
+}
+
+// TestWarehouse_Reservations checks crossing robots are sequenced by their reservations and priorities
+func TestWarehouse_Reservations(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock), WithReservations())
+	events, cancel := w.Subscribe(EventRobotYielded, EventReservationRevoked)
+	defer cancel()
+
+	// R1 heads east along y=1 and R2 heads south along x=2; both would reach (2,1) at tick 1
+	r1, _ := AddRobot(w, 0, 1, "R1")
+	r2, _ := AddRobot(w, 2, 3, "R2")
+	r2.SetPriority(1)
+
+	_, _, errCh1 := r1.EnqueueTask("E E E")
+	clock.BlockUntil(1) // R1 has moved to (1,1) and holds (2,1) for tick 1
+	_, _, errCh2 := r2.EnqueueTask("S S S")
+	clock.BlockUntil(2) // R2 has taken over (2,1) and moved to (2,2)
+
+	// R1 yields while R2 crosses at ticks 1 and 2, then follows on at ticks 3 and 4
+	for _, waiters := range []int{2, 2, 2, 1, 1} {
+		clock.BlockUntil(waiters)
+		clock.Advance(CommandExecutionTime)
+	}
+	for _, errCh := range []chan error{errCh1, errCh2} {
+		for err := range errCh {
+			if err != nil {
+				t.Errorf("Expected tasks to complete, got %v", err)
+			}
+		}
+	}
+	if state := r1.CurrentState(); state.X != 3 || state.Y != 1 {
+		t.Errorf("Expected R1 at (3,1), got (%d,%d)", state.X, state.Y)
+	}
+	if state := r2.CurrentState(); state.X != 2 || state.Y != 0 {
+		t.Errorf("Expected R2 at (2,0), got (%d,%d)", state.X, state.Y)
+	}
+
+	if ev := <-events; ev.Type != EventReservationRevoked || ev.RobotID != "R1" || ev.BlockedBy != "R2" {
+		t.Errorf("Expected R1's reservations to be taken over by R2, got %+v", ev)
+	}
+	yields := 0
+	for len(events) > 0 {
+		if ev := <-events; ev.Type == EventRobotYielded && ev.RobotID == "R1" && ev.BlockedBy == "R2" {
+			yields++
+		}
+	}
+	if yields != 2 {
+		t.Errorf("Expected R1 to yield to R2 for 2 ticks, got %d", yields)
+	}
+}
+
+// TestWarehouse_Deadlock checks robots waiting for each other head-on are detected and resolved
+func TestWarehouse_Deadlock(t *testing.T) {
+	// setup creates R1 at (0,0) and R2 at (1,0), each waiting to move into the other's cell
+	setup := func(strategy DeadlockStrategy) (*FakeClock, Robot, Robot, chan error, chan error, <-chan Event) {
+		clock := newTestClock()
+		w := NewWarehouse(WithClock(clock), WithCollisionPolicy(WaitOnCollision(time.Hour)), WithDeadlockStrategy(strategy))
+		events, cancel := w.Subscribe(EventDeadlockDetected, EventRobotRerouted)
+		t.Cleanup(cancel)
+		r1, _ := AddRobot(w, 0, 0, "R1")
+		r2, _ := AddRobot(w, 1, 0, "R2")
+		_, _, errCh1 := r1.EnqueueTask("E")
+		clock.BlockUntil(1) // R1 waiting for R2
+		_, _, errCh2 := r2.EnqueueTask("W")
+		return clock, r1, r2, errCh1, errCh2, events
+	}
+	finalErr := func(errCh chan error) error {
+		var err error
+		for e := range errCh {
+			err = e
+		}
+		return err
+	}
+
+	t.Run("abort", func(t *testing.T) {
+		_, r1, _, _, errCh2, events := setup(DeadlockAbort)
+		if err := finalErr(errCh2); err != ErrDeadlock {
+			t.Errorf("Expected %v for the robot completing the cycle, got %v", ErrDeadlock, err)
+		}
+		ev := <-events
+		if ev.Type != EventDeadlockDetected || ev.RobotID != "R2" || strings.Join(ev.Robots, ",") != "R2,R1" {
+			t.Errorf("Unexpected event %+v", ev)
+		}
+		if state := r1.CurrentState(); state.X != 0 || state.Y != 0 {
+			t.Errorf("Expected R1 still waiting at (0,0), got (%d,%d)", state.X, state.Y)
+		}
+	})
+
+	t.Run("lowest priority gives way", func(t *testing.T) {
+		clock := newTestClock()
+		w := NewWarehouse(WithClock(clock), WithCollisionPolicy(WaitOnCollision(time.Hour)))
+		r1, _ := AddRobot(w, 0, 0, "R1")
+		r2, _ := AddRobot(w, 1, 0, "R2")
+		r2.SetPriority(1)
+		_, _, errCh1 := r1.EnqueueTask("E")
+		clock.BlockUntil(1)
+		r2.EnqueueTask("W")
+		if err := finalErr(errCh1); err != ErrDeadlock {
+			t.Errorf("Expected %v for the lower priority robot, got %v", ErrDeadlock, err)
+		}
+	})
+
+	t.Run("back off", func(t *testing.T) {
+		clock, r1, r2, errCh1, errCh2, events := setup(DeadlockBackOff)
+		clock.BlockUntil(2) // R2 has stepped aside to (1,1)
+		clock.Advance(CollisionRetryInterval)
+		clock.BlockUntil(2) // R1 has moved into (1,0)
+		clock.Advance(CommandExecutionTime)
+		for range 2 { // R2 goes around R1
+			clock.BlockUntil(1)
+			clock.Advance(CommandExecutionTime)
+		}
+		for _, errCh := range []chan error{errCh1, errCh2} {
+			if err := finalErr(errCh); err != nil {
+				t.Errorf("Expected tasks to complete, got %v", err)
+			}
+		}
+		if state := r1.CurrentState(); state.X != 1 || state.Y != 0 {
+			t.Errorf("Expected R1 at (1,0), got (%d,%d)", state.X, state.Y)
+		}
+		if state := r2.CurrentState(); state.X != 0 || state.Y != 0 {
+			t.Errorf("Expected R2 at (0,0), got (%d,%d)", state.X, state.Y)
+		}
+		if ev := <-events; ev.Type != EventDeadlockDetected || ev.RobotID != "R2" {
+			t.Errorf("Unexpected event %+v", ev)
+		}
+		if ev := <-events; ev.Type != EventRobotRerouted || ev.RobotID != "R2" || ev.X != 0 || ev.Y != 0 {
+			t.Errorf("Unexpected event %+v", ev)
+		}
+	})
+
+	t.Run("back off respects reservations", func(t *testing.T) {
+		clock := newTestClock()
+		w := NewWarehouse(WithClock(clock), WithReservations())
+		r1, _ := AddRobot(w, 0, 0, "R1")
+		AddRobot(w, 2, 2, "R3")
+		wh := w.(*warehouseImpl)
+		tick := wh.currentTick()
+		wh.reservations.tryReserve("R3", 1, []spaceTime{{1, 0, tick}, {1, 0, tick + 1}}, func(x, y uint) string { return "" })
+
+		impl := r1.(*robotImpl)
+		if impl.reserveBackOff('E') {
+			t.Error("Expected R1 not to back off into a cell reserved by R3")
+		}
+		if !impl.reserveBackOff('N') {
+			t.Error("Expected R1 to reserve a free cell to back off into")
+		}
+		if !wh.reservations.holds("R1", spaceTime{0, 1, tick}, spaceTime{0, 1, tick + 1}) {
+			t.Error("Expected R1 to hold the cell it backs off into while it waits")
+		}
+	})
+}
+
+// TestWarehouse_Obstacles checks obstacle cells cannot be entered, occupied or planned through
+func TestWarehouse_Obstacles(t *testing.T) {
+	clock := newTestClock()
+	cw := NewCrateWarehouse(WithClock(clock))
+	events, cancel := cw.Subscribe(EventObstacleAdded, EventObstacleRemoved)
+	defer cancel()
+
+	// A wall along x=1 from y=0 to y=2
+	for y := uint(0); y < 3; y++ {
+		if err := cw.AddObstacle(1, y); err != nil {
+			t.Fatalf("Failed to add obstacle at (1,%d): %v", y, err)
+		}
+	}
+	if err := cw.AddObstacle(1, 0); err != ErrObstacle {
+		t.Errorf("Expected %v adding obstacle twice, got %v", ErrObstacle, err)
+	}
+	if err := cw.AddObstacle(GridSize, 0); err != ErrOutOfBounds {
+		t.Errorf("Expected %v adding obstacle outside the grid, got %v", ErrOutOfBounds, err)
+	}
+	if _, err := AddRobot(cw, 1, 1, "R0"); err != ErrObstacle {
+		t.Errorf("Expected %v adding robot on an obstacle, got %v", ErrObstacle, err)
+	}
+	if _, err := AddDiagonalRobot(cw, 1, 2, "R0"); err != ErrObstacle {
+		t.Errorf("Expected %v adding diagonal robot on an obstacle, got %v", ErrObstacle, err)
+	}
+	if err := cw.AddCrate(1, 0); err != ErrObstacle {
+		t.Errorf("Expected %v adding crate on an obstacle, got %v", ErrObstacle, err)
+	}
+
+	r, _ := AddRobot(cw, 0, 0, "R1")
+	if err := cw.AddObstacle(0, 0); err != ErrPositionOccupied {
+		t.Errorf("Expected %v adding obstacle under a robot, got %v", ErrPositionOccupied, err)
+	}
+
+	// Moving into the wall aborts the task
+	_, _, errCh := r.EnqueueTask("E")
+	if err := <-errCh; err != ErrObstacle {
+		t.Errorf("Expected %v moving into an obstacle, got %v", ErrObstacle, err)
+	}
+	if sim, err := r.Simulate("N E"); err != ErrObstacle || sim.FailedIndex != 1 {
+		t.Errorf("Expected simulation to fail on the obstacle, got %+v, %v", sim, err)
+	}
+
+	// Paths go around the wall
+	_, commands, _, _ := r.MoveTo(2, 0)
+	if commands != "N N N E E S S S" {
+		t.Errorf("Expected path around the wall, got %q", commands)
+	}
+	if _, _, _, errCh := r.MoveTo(1, 1); <-errCh != ErrObstacle {
+		t.Error("Expected MoveTo an obstacle to fail")
+	}
+
+	if err := cw.DelObstacle(1, 0); err != nil {
+		t.Errorf("Failed to delete obstacle: %v", err)
+	}
+	if err := cw.DelObstacle(1, 0); err != ErrObstacleNotFound {
+		t.Errorf("Expected %v deleting obstacle twice, got %v", ErrObstacleNotFound, err)
+	}
+	if sim, err := r.Simulate("W"); err != nil {
+		t.Errorf("Expected move into cleared cell to succeed, got %+v, %v", sim, err)
+	}
+	if len(events) != 4 {
+		t.Errorf("Expected 3 obstacle added and 1 removed event, got %d", len(events))
+	}
+
+	// Render draws obstacles distinctly
+	var buf bytes.Buffer
+	stdout := os.Stdout
+	pr, pw, _ := os.Pipe()
+	os.Stdout = pw
+	Render(cw, nil)
+	pw.Close()
+	os.Stdout = stdout
+	buf.ReadFrom(pr)
+	if lines := strings.Split(buf.String(), "\n"); !strings.HasPrefix(lines[GridSize-1], " - ###") {
+		t.Errorf("Expected obstacle at (1,1) to render as ###, got %q", lines[GridSize-1])
+	}
+}
+
+// TestLayout checks layouts are parsed from text and JSON and loaded into a warehouse
+func TestLayout(t *testing.T) {
+	text := `--- Warehouse Real-Time View ---
+ - ### - R2*
+R1_### - [C]
+--------------------------------
+diagonal R1
+priority R2 3
+location dock 3 0
+`
+	l, err := ParseLayout([]byte(text))
+	if err != nil {
+		t.Fatalf("Failed to parse text layout: %v", err)
+	}
+	if l.Width != 4 || l.Height != 2 || len(l.Obstacles) != 2 || len(l.Crates) != 2 || len(l.Robots) != 2 {
+		t.Fatalf("Unexpected layout %+v", l)
+	}
+
+	// The JSON form holds the same layout
+	data, _ := json.Marshal(l)
+	fromJSON, err := ParseLayout(data)
+	if err != nil {
+		t.Fatalf("Failed to parse JSON layout: %v", err)
+	}
+	if again, _ := json.Marshal(fromJSON); string(again) != string(data) {
+		t.Errorf("Expected JSON layout %s, got %s", data, again)
+	}
+
+	cw, robots, err := LoadLayout(fromJSON, WithClock(newTestClock()))
+	if err != nil {
+		t.Fatalf("Failed to load layout: %v", err)
+	}
+	if width, height := cw.Size(); width != 4 || height != 2 {
+		t.Errorf("Expected size 4x2, got %dx%d", width, height)
+	}
+	if loc, ok := cw.Locations()["dock"]; !ok || loc.X != 3 || loc.Y != 0 {
+		t.Errorf("Expected dock at (3,0), got %+v", cw.Locations())
+	}
+	if err := cw.AddObstacle(1, 0); err != ErrObstacle {
+		t.Errorf("Expected obstacle at (1,0), got %v", err)
+	}
+	if err := cw.AddCrate(3, 0); err != ErrCrateExists {
+		t.Errorf("Expected crate at (3,0), got %v", err)
+	}
+	r1, r2 := robots["R1"].(*robotImpl), robots["R2"].(*robotImpl)
+	if state := r1.CurrentState(); state.X != 0 || state.Y != 0 || state.HasCrate || !r1.isDiagonal {
+		t.Errorf("Expected diagonal R1 on a crate at (0,0), got %+v", state)
+	}
+	if state := r2.CurrentState(); state.X != 3 || state.Y != 1 || !state.HasCrate || r2.priority != 3 {
+		t.Errorf("Expected R2 carrying a crate at (3,1) with priority 3, got %+v", state)
+	}
+
+	// Render's output is a text layout
+	var buf bytes.Buffer
+	stdout := os.Stdout
+	pr, pw, _ := os.Pipe()
+	os.Stdout = pw
+	Render(cw, nil)
+	pw.Close()
+	os.Stdout = stdout
+	buf.ReadFrom(pr)
+	rendered, err := ParseLayout(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse rendered layout: %v\n%s", err, buf.String())
+	}
+	if len(rendered.Obstacles) != 2 || len(rendered.Crates) != 2 || len(rendered.Robots) != 2 || rendered.Width != 4 {
+		t.Errorf("Expected rendered layout to match, got %+v", rendered)
+	}
+
+	for _, bad := range []string{
+		" - - \n - ",                  // Rows of different widths
+		" - ?? [x]",                   // Unrecognised cell
+		" - R1\nlocation dock 1",      // Malformed directive
+		" - R1\ndiagonal R2",          // Directive for a robot not on the grid
+		`{"width": 2, "robots": [1]}`, // Malformed JSON
+	} {
+		if _, err := ParseLayout([]byte(bad)); !errors.Is(err, ErrInvalidLayout) {
+			t.Errorf("Expected %v parsing %q, got %v", ErrInvalidLayout, bad, err)
+		}
+	}
+	conflict := Layout{Width: 3, Height: 3, Obstacles: []Position{{1, 1}}, Robots: []LayoutRobot{{ID: "R0"}, {ID: "R1", X: 1, Y: 1}}}
+	expectNoLeak(t, func() {
+		if _, _, err := LoadLayout(conflict); !errors.Is(err, ErrInvalidLayout) || !errors.Is(err, ErrObstacle) {
+			t.Errorf("Expected %v for a robot on an obstacle, got %v", ErrObstacle, err)
+		}
+	})
+}
+
+// expectNoLeak fails the test if goroutines started by f, such as robot workers, are still running soon after it returns.
+func expectNoLeak(t *testing.T, f func()) {
+	t.Helper()
+	before := runtime.NumGoroutine()
+	f()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Errorf("Expected no goroutines left behind, got %d more", runtime.NumGoroutine()-before)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestWarehouse_Snapshot checks a warehouse is restored with its robots and resumes their tasks
+func TestWarehouse_Snapshot(t *testing.T) {
+	clock := newTestClock()
+	cw := NewCrateWarehouse(WithClock(clock), WithGridSize(5, 5))
+	cw.AddObstacle(4, 4)
+	cw.AddCrate(2, 2)
+	r1, _ := AddDiagonalRobot(cw, 2, 2, "R1")
+	r1.SetPriority(2)
+	r2, _ := AddRobot(cw, 0, 0, "R2")
+
+	r1.EnqueueTask("G")
+	running, _, _ := r2.EnqueueTask("N N N")
+	clock.BlockUntil(2) // R1 has the crate and R2 has moved to (0,1)
+	queued, _, _ := r2.EnqueueTask("E")
+
+	data, err := cw.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	var snap Snapshot
+	json.Unmarshal(data, &snap)
+	if len(snap.Robots) != 2 || snap.Robots[0].ID != "R1" || len(snap.Robots[1].Tasks) != 2 || snap.Robots[1].Tasks[0].Executed != 1 {
+		t.Fatalf("Unexpected snapshot:\n%s", data)
+	}
+
+	restoredClock := newTestClock()
+	w, robots, err := Restore(data, WithClock(restoredClock))
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, ok := w.(CrateWarehouse); !ok {
+		t.Error("Expected a crate warehouse")
+	}
+	if width, height := w.Size(); width != 5 || height != 5 {
+		t.Errorf("Expected size 5x5, got %dx%d", width, height)
+	}
+	if err := w.AddObstacle(4, 4); err != ErrObstacle {
+		t.Errorf("Expected obstacle to be restored, got %v", err)
+	}
+	restored1 := robots["R1"].(*robotImpl)
+	if state := restored1.CurrentState(); state.X != 2 || state.Y != 2 || !state.HasCrate || !restored1.isDiagonal || restored1.priority != 2 {
+		t.Errorf("Expected diagonal R1 carrying a crate at (2,2), got %+v", state)
+	}
+
+	// R2 resumes its running task from its second command, then runs its queued task
+	for range 3 {
+		restoredClock.BlockUntil(1)
+		restoredClock.Advance(CommandExecutionTime)
+	}
+	restored2 := robots["R2"]
+	for _, taskID := range []string{running, queued} {
+		for {
+			status, _ := restored2.TaskStatus(taskID)
+			if status.State.Finished() {
+				if status.State != TaskCompleted {
+					t.Errorf("Expected task %s to complete, got %+v", taskID, status)
+				}
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if status, _ := restored2.TaskStatus(running); status.CommandsExecuted != 3 {
+		t.Errorf("Expected 3 commands executed across the snapshot, got %d", status.CommandsExecuted)
+	}
+	if state := restored2.CurrentState(); state.X != 1 || state.Y != 3 {
+		t.Errorf("Expected R2 at (1,3), got (%d,%d)", state.X, state.Y)
+	}
+
+	for _, bad := range []string{
+		`not json`,
+		`{"version": 99}`,
+		`{"version": 1, "width": 3, "height": 3, "robots": [{"id": "R1", "state": {"X": 5, "Y": 0}}]}`,
+		`{"version": 1, "robots": [{"id": "R1", "tasks": [{"id": "t", "cmds": "N?"}]}]}`,
+		`{"version": 1, "width": 3, "height": 3, "robots": [{"id": "R1"}, {"id": "R1", "state": {"X": 1, "Y": 0}}]}`,
+	} {
+		expectNoLeak(t, func() {
+			if _, _, err := Restore([]byte(bad)); !errors.Is(err, ErrInvalidSnapshot) {
+				t.Errorf("Expected %v restoring %s, got %v", ErrInvalidSnapshot, bad, err)
+			}
+		})
+	}
+}
+
+// TestWarehouse_Journal checks a journalled warehouse is replayed with each recovery policy
+func TestWarehouse_Journal(t *testing.T) {
+	// run journals a warehouse where R1 has executed one of "N N N" and has "E" queued, then replays the journal
+	run := func(t *testing.T, recovery RecoveryPolicy) (*FakeClock, Warehouse, string, string) {
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+		clock := newTestClock()
+		cw := NewCrateWarehouse(WithClock(clock), WithJournal(path, recovery))
+		cw.AddCrate(3, 3)
+		cw.AddObstacle(4, 4)
+		r1, _ := AddRobot(cw, 0, 0, "R1")
+		running, _, _ := r1.EnqueueTask("N N N")
+		clock.BlockUntil(1) // R1 has moved to (0,1)
+		queued, _, _ := r1.EnqueueTask("E")
+		r2, _ := AddRobot(cw, 5, 0, "R2")
+		_, _, errCh := r2.EnqueueTask("S")
+		<-errCh // R2's task has failed, so is not replayed
+
+		restoredClock := newTestClock()
+		return restoredClock, NewCrateWarehouse(WithClock(restoredClock), WithJournal(path, recovery)), running, queued
+	}
+	robot := func(w Warehouse, id string) Robot {
+		for _, r := range w.Robots() {
+			if r.(*robotImpl).id == id {
+				return r
+			}
+		}
+		t.Fatalf("Robot %s not restored", id)
+		return nil
+	}
+	finish := func(clock *FakeClock, commands int) {
+		for range commands {
+			clock.BlockUntil(1)
+			clock.Advance(CommandExecutionTime)
+		}
+	}
+
+	for _, tc := range []struct {
+		recovery RecoveryPolicy
+		commands int  // Commands left to execute
+		x, y     uint // Where R1 ends up
+	}{
+		{RecoverResume, 3, 1, 3},
+		{RecoverRestart, 4, 1, 4},
+		{RecoverDiscard, 1, 1, 1},
+	} {
+		t.Run(string(tc.recovery), func(t *testing.T) {
+			clock, w, running, queued := run(t, tc.recovery)
+			if len(w.Robots()) != 2 {
+				t.Fatalf("Expected 2 robots, got %d", len(w.Robots()))
+			}
+			if state := robot(w, "R2").CurrentState(); state.X != 5 || state.Y != 0 {
+				t.Errorf("Expected R2 at (5,0), got (%d,%d)", state.X, state.Y)
+			}
+			if err := w.AddObstacle(4, 4); err != ErrObstacle {
+				t.Errorf("Expected obstacle to be restored, got %v", err)
+			}
+			if err := w.(CrateWarehouse).AddCrate(3, 3); err != ErrCrateExists {
+				t.Errorf("Expected crate to be restored, got %v", err)
+			}
+
+			r1 := robot(w, "R1")
+			finish(clock, tc.commands)
+			waitForTask(t, r1, queued)
+			if state := r1.CurrentState(); state.X != tc.x || state.Y != tc.y {
+				t.Errorf("Expected R1 at (%d,%d), got (%d,%d)", tc.x, tc.y, state.X, state.Y)
+			}
+			status, _ := r1.TaskStatus(running)
+			if tc.recovery == RecoverDiscard {
+				if status.State != TaskFailed || status.Err != ErrTaskInterrupted {
+					t.Errorf("Expected interrupted task to be discarded, got %+v", status)
+				}
+			} else if status.State != TaskCompleted {
+				t.Errorf("Expected interrupted task to complete, got %+v", status)
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+		w := NewWarehouse(WithJournal(path, RecoverResume))
+		AddRobot(w, 2, 2, "R1")
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+		f.WriteString(`{"op": "robot", "robot": "R2", "sta`) // Crashed while writing
+		f.Close()
+
+		if restored := NewWarehouse(WithJournal(path, RecoverResume)); len(restored.Robots()) != 1 {
+			t.Errorf("Expected the truncated entry to be ignored, got %d robots", len(restored.Robots()))
+		}
+	})
+}
+
+// waitForTask waits for a task to finish, failing the test if it takes more than a second of real time.
+func waitForTask(t *testing.T, r Robot, taskID string) TaskStatus {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, err := r.TaskStatus(taskID)
+		if err != nil || status.State.Finished() {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timeout waiting for task %s: %+v", taskID, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestWarehouse_RemoveRobot checks a removed robot stops, frees its cell and handles its tasks and crate as asked
+func TestWarehouse_RemoveRobot(t *testing.T) {
+	clock := newTestClock()
+	cw := NewCrateWarehouse(WithClock(clock))
+	events, cancel := cw.Subscribe(EventRobotRemoved)
+	defer cancel()
+	removed := make(chan error)
+
+	// R1 is removed part way through a task, with another queued; both are cancelled
+	r1, _ := AddRobot(cw, 0, 0, "R1")
+	running, _, _ := r1.EnqueueTask("N N N")
+	queued, _, _ := r1.EnqueueTask("E")
+	clock.BlockUntil(1) // R1 has moved to (0,1)
+	go func() { removed <- RemoveRobot(cw, "R1", RemovalPolicy{}) }()
+	for status, _ := r1.TaskStatus(queued); status.State != TaskCancelled; status, _ = r1.TaskStatus(queued) {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(CommandExecutionTime)
+	if err := <-removed; err != nil {
+		t.Fatalf("RemoveRobot failed: %v", err)
+	}
+	if status, _ := r1.TaskStatus(running); status.State != TaskCancelled || status.CommandsExecuted != 1 {
+		t.Errorf("Expected running task cancelled after 1 command, got %+v", status)
+	}
+	if len(cw.Robots()) != 0 || cw.(*warehouseImpl).gridyx[1][0] != "" {
+		t.Error("Expected R1 to be gone from the warehouse and its cell")
+	}
+	if ev := <-events; ev.RobotID != "R1" || ev.State.Y != 1 {
+		t.Errorf("Unexpected event %+v", ev)
+	}
+	if taskID, _, errCh := r1.EnqueueTask("S"); taskID != "" || <-errCh != ErrRobotRemoved {
+		t.Error("Expected a removed robot to reject tasks")
+	}
+	if err := RemoveRobot(cw, "R1", RemovalPolicy{}); err != ErrRobotNotFound {
+		t.Errorf("Expected %v removing R1 again, got %v", ErrRobotNotFound, err)
+	}
+	if _, err := AddRobot(cw, 0, 1, "R3"); err != nil {
+		t.Errorf("Expected R1's cell to be free, got %v", err)
+	}
+
+	// R2 is drained, picking up a crate, so it stays until removed with a policy which drops the crate
+	cw.AddCrate(5, 6)
+	r2, _ := AddRobot(cw, 5, 5, "R2")
+	r2.EnqueueTask("N G")
+	go func() { removed <- RemoveRobot(cw, "R2", RemovalPolicy{Drain: true}) }()
+	for range 2 {
+		clock.BlockUntil(1)
+		clock.Advance(CommandExecutionTime)
+	}
+	if err := <-removed; err != ErrRobotHasCrate {
+		t.Fatalf("Expected %v, got %v", ErrRobotHasCrate, err)
+	}
+	if err := RemoveRobot(cw, "R2", RemovalPolicy{}); err != ErrRobotHasCrate {
+		t.Errorf("Expected %v, got %v", ErrRobotHasCrate, err)
+	}
+	if taskID, _, _ := r2.EnqueueTask("S"); taskID == "" {
+		t.Fatal("Expected R2 to keep working after a failed removal")
+	}
+	go func() { removed <- RemoveRobot(cw, "R2", RemovalPolicy{Drain: true, DropCrate: true}) }()
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	if err := <-removed; err != nil {
+		t.Fatalf("RemoveRobot failed: %v", err)
+	}
+	wh := cw.(*warehouseImpl)
+	if !wh.cratesyx[5][5] || wh.gridyx[5][5] != "" {
+		t.Error("Expected R2 to drop its crate at (5,5) and leave")
+	}
+
+	// R4 is paused, so draining it never finishes; its task is cancelled once the context is done
+	r4, _ := AddRobot(cw, 9, 9, "R4")
+	r4.Pause()
+	paused, _, _ := r4.EnqueueTask("S")
+	ctx, cancelRemove := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelRemove()
+	if err := RemoveRobotContext(ctx, cw, "R4", RemovalPolicy{Drain: true}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v draining a paused robot, got %v", context.DeadlineExceeded, err)
+	}
+	if status, _ := r4.TaskStatus(paused); status.State != TaskCancelled {
+		t.Errorf("Expected the paused robot's task to be cancelled, got %+v", status)
+	}
+	if wh.gridyx[9][9] != "" {
+		t.Error("Expected R4 to be removed")
+	}
+}
+
+// TestWarehouse_Close checks closing a warehouse cancels or drains pending tasks and stops its robots
+func TestWarehouse_Close(t *testing.T) {
+	t.Run("cancel", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+		clock := newTestClock()
+		cw := NewCrateWarehouse(WithClock(clock), WithJournal(path, RecoverResume))
+		r1, _ := AddRobot(cw, 0, 0, "R1")
+		running, _, _ := r1.EnqueueTask("N N N")
+		queued, _, _ := r1.EnqueueTask("E")
+		clock.BlockUntil(1) // R1 has moved to (0,1)
+
+		type result struct {
+			abandoned []AbandonedTask
+			err       error
+		}
+		closed := make(chan result)
+		go func() {
+			abandoned, err := cw.Close(context.Background())
+			closed <- result{abandoned, err}
+		}()
+		for status, _ := r1.TaskStatus(queued); status.State != TaskCancelled; status, _ = r1.TaskStatus(queued) {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(CommandExecutionTime)
+		res := <-closed
+		if res.err != nil {
+			t.Fatalf("Close failed: %v", res.err)
+		}
+		if len(res.abandoned) != 2 || res.abandoned[0].Status.ID != running || res.abandoned[1].Status.ID != queued ||
+			res.abandoned[0].RobotID != "R1" || res.abandoned[0].Status.CommandsExecuted != 1 {
+			t.Errorf("Unexpected abandoned tasks %+v", res.abandoned)
+		}
+
+		if taskID, _, errCh := r1.EnqueueTask("S"); taskID != "" || <-errCh != ErrWarehouseClosed {
+			t.Error("Expected a closed warehouse to reject tasks")
+		}
+		if _, err := AddRobot(cw, 5, 5, "R2"); err != ErrWarehouseClosed {
+			t.Errorf("Expected %v adding a robot, got %v", ErrWarehouseClosed, err)
+		}
+		if _, err := cw.Close(context.Background()); err != ErrWarehouseClosed {
+			t.Errorf("Expected %v closing again, got %v", ErrWarehouseClosed, err)
+		}
+
+		// The abandoned tasks are queued again when the journal is replayed
+		w := NewCrateWarehouse(WithClock(newTestClock()), WithJournal(path, RecoverResume))
+		restored := w.Robots()[0]
+		if state := restored.CurrentState(); state.X != 0 || state.Y != 1 {
+			t.Errorf("Expected R1 at (0,1), got (%d,%d)", state.X, state.Y)
+		}
+		for _, taskID := range []string{running, queued} {
+			if _, err := restored.TaskStatus(taskID); err != nil {
+				t.Errorf("Expected task %s to be replayed, got %v", taskID, err)
+			}
+		}
+	})
+
+	t.Run("drain", func(t *testing.T) {
+		clock := newTestClock()
+		w := NewWarehouse(WithClock(clock), WithShutdownPolicy(ShutdownDrain))
+		r1, _ := AddRobot(w, 0, 0, "R1")
+		taskID, _, _ := r1.EnqueueTask("N N")
+		clock.BlockUntil(1)
+
+		closed := make(chan error)
+		go func() {
+			abandoned, err := w.Close(context.Background())
+			if len(abandoned) != 0 {
+				t.Errorf("Expected no abandoned tasks, got %+v", abandoned)
+			}
+			closed <- err
+		}()
+		clock.Advance(CommandExecutionTime)
+		clock.BlockUntil(1)
+		clock.Advance(CommandExecutionTime)
+		if err := <-closed; err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if status, _ := r1.TaskStatus(taskID); status.State != TaskCompleted {
+			t.Errorf("Expected drained task to complete, got %+v", status)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		clock := newTestClock()
+		w := NewWarehouse(WithClock(clock), WithShutdownPolicy(ShutdownDrain))
+		r1, _ := AddRobot(w, 0, 0, "R1")
+		taskID, _, errCh := r1.EnqueueTask("N N N")
+		clock.BlockUntil(1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		abandoned, err := w.Close(ctx)
+		if err != context.Canceled {
+			t.Errorf("Expected %v, got %v", context.Canceled, err)
+		}
+		if len(abandoned) != 1 || abandoned[0].Status.ID != taskID {
+			t.Errorf("Unexpected abandoned tasks %+v", abandoned)
+		}
+		clock.Advance(CommandExecutionTime)
+		for range errCh {
+		}
+		if status, _ := r1.TaskStatus(taskID); status.State != TaskCancelled {
+			t.Errorf("Expected abandoned task to be cancelled, got %+v", status)
+		}
+	})
+}
+
+// TestRobot_Wait checks waiting for tasks, and cancelling them with their context
+func TestRobot_Wait(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock))
+	r1, _ := AddRobot(w, 0, 0, "R1")
+
+	running, _, _ := r1.EnqueueTask("N N N")
+	ctx, cancel := context.WithCancel(context.Background())
+	queued, _, _ := r1.EnqueueTaskContext(ctx, "E")
+	clock.BlockUntil(1)
+
+	// Cancelling the context cancels the queued task
+	cancel()
+	result, err := r1.Wait(context.Background(), queued)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if result.State != TaskCancelled || result.Err != ErrTaskCancelled || result.Duration != 0 {
+		t.Errorf("Expected queued task to be cancelled, got %+v", result)
+	}
+	if taskID, _, errCh := r1.EnqueueTaskContext(ctx, "E"); taskID != "" || <-errCh != context.Canceled {
+		t.Error("Expected a done context to be rejected")
+	}
+
+	// Waiting gives up when its own context is done
+	if _, err := r1.Wait(ctx, running); err != context.Canceled {
+		t.Errorf("Expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := r1.Wait(context.Background(), "unknown"); err != ErrTaskNotFound {
+		t.Errorf("Expected %v, got %v", ErrTaskNotFound, err)
+	}
+
+	clock.Advance(CommandExecutionTime)
+	for range 2 {
+		clock.BlockUntil(1)
+		clock.Advance(CommandExecutionTime)
+	}
+	result, err = r1.Wait(context.Background(), running)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if result.State != TaskCompleted || result.Err != nil || result.CommandsExecuted != 3 ||
+		result.FinalState.Y != 3 || result.Duration != 3*CommandExecutionTime {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func TestRobot_TaskPriority(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock))
+	r1, _ := AddRobot(w, 0, 0, "R1")
+
+	first, _, _ := r1.EnqueueTask("N N N")
+	clock.BlockUntil(1)
+	low, _, _ := r1.EnqueueTask("E", WithTaskPriority(PriorityLow))
+	normal, _, _ := r1.EnqueueTask("E")
+	high, _, _ := r1.EnqueueTask("E", WithTaskPriority(PriorityHigh))
+	urgent, _, _ := r1.EnqueueTask("S", WithTaskPriority(PriorityUrgent), WithPreemption(PreemptSuspend))
+	if status, _ := r1.TaskStatus(high); status.Priority != PriorityHigh {
+		t.Errorf("Expected priority %d, got %d", PriorityHigh, status.Priority)
+	}
+
+	// The urgent task suspends the first task, which resumes ahead of the queued tasks
+	for range 7 {
+		clock.BlockUntil(1)
+		clock.Advance(CommandExecutionTime)
+	}
+	result, err := r1.Wait(context.Background(), low)
+	if err != nil || result.State != TaskCompleted {
+		t.Fatalf("Expected the low priority task to complete, got %+v, %v", result, err)
+	}
+	firstStatus, _ := r1.TaskStatus(first)
+	urgentStatus, _ := r1.TaskStatus(urgent)
+	if firstStatus.State != TaskCompleted || firstStatus.CommandsExecuted != 3 {
+		t.Errorf("Expected the suspended task to complete, got %+v", firstStatus)
+	}
+	if !urgentStatus.EndedAt.Before(firstStatus.EndedAt) || urgentStatus.StartedAt.Before(firstStatus.StartedAt) {
+		t.Errorf("Expected the urgent task to run while the first task was suspended, got %+v and %+v", urgentStatus, firstStatus)
+	}
+	var previous TaskStatus = firstStatus
+	for _, taskID := range []string{high, normal, low} {
+		status, _ := r1.TaskStatus(taskID)
+		if !status.StartedAt.After(previous.StartedAt) {
+			t.Errorf("Expected task %s to start after task %s", taskID, previous.ID)
+		}
+		previous = status
+	}
+	if state := r1.CurrentState(); state.X != 3 || state.Y != 2 {
+		t.Errorf("Expected robot at (3, 2), got (%d, %d)", state.X, state.Y)
+	}
+
+	// Only a task of higher priority can preempt, and aborting cancels the running task
+	r2, _ := AddRobot(w, 5, 5, "R2")
+	running, _, errCh := r2.EnqueueTask("N N N")
+	clock.BlockUntil(1)
+	same, _, _ := r2.EnqueueTask("W", WithPreemption(PreemptAbort))
+	clock.Advance(CommandExecutionTime)
+	clock.BlockUntil(1)
+	aborting, _, _ := r2.EnqueueTask("E", WithTaskPriority(PriorityHigh), WithPreemption(PreemptAbort))
+	clock.Advance(CommandExecutionTime)
+	if err := <-errCh; err != ErrTaskPreempted {
+		t.Errorf("Expected %v, got %v", ErrTaskPreempted, err)
+	}
+	result, _ = r2.Wait(context.Background(), running)
+	if result.State != TaskCancelled || result.CommandsExecuted != 2 {
+		t.Errorf("Expected the running task to be aborted after 2 commands, got %+v", result)
+	}
+	for range 2 {
+		clock.BlockUntil(1)
+		clock.Advance(CommandExecutionTime)
+	}
+	for _, taskID := range []string{aborting, same} {
+		if result, _ := r2.Wait(context.Background(), taskID); result.State != TaskCompleted {
+			t.Errorf("Expected task %s to complete, got %+v", taskID, result)
+		}
+	}
+}
+
+func TestRobot_Queue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock), WithQueueCapacity(3), WithJournal(path, RecoverResume))
+	r1, _ := AddRobot(w, 0, 0, "R1")
+	ids := func(statuses []TaskStatus) []string {
+		var taskIDs []string
+		for _, status := range statuses {
+			taskIDs = append(taskIDs, status.ID)
+		}
+		return taskIDs
+	}
+
+	running, _, _ := r1.EnqueueTask("N N N")
+	clock.BlockUntil(1)
+	a, _, _ := r1.EnqueueTask("E")
+	b, _, _ := r1.EnqueueTask("E")
+	c, _, _ := r1.EnqueueTask("W")
+	if taskID, _, errCh := r1.EnqueueTask("S"); taskID != "" || <-errCh != ErrQueueFull {
+		t.Error("Expected a task to be rejected when the queue is full")
+	}
+	if queued := ids(r1.ListQueuedTasks()); !slices.Equal(queued, []string{a, b, c}) {
+		t.Errorf("Expected queue %v, got %v", []string{a, b, c}, queued)
+	}
+
+	// Reordering moves the listed tasks to the front
+	if err := r1.ReorderTasks([]string{c, a}); err != nil {
+		t.Fatalf("ReorderTasks failed: %v", err)
+	}
+	if err := r1.ReorderTasks([]string{b, running}); !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("Expected %v reordering the running task, got %v", ErrTaskNotFound, err)
+	}
+	if queued := ids(r1.ListQueuedTasks()); !slices.Equal(queued, []string{c, a, b}) {
+		t.Errorf("Expected queue %v, got %v", []string{c, a, b}, queued)
+	}
+
+	// The order is replayed from the journal, after the interrupted task
+	restoredClock := newTestClock()
+	restored := NewWarehouse(WithClock(restoredClock), WithJournal(path, RecoverResume))
+	restoredClock.BlockUntil(1)
+	if queued := ids(restored.Robots()[0].ListQueuedTasks()); !slices.Equal(queued, []string{c, a, b}) {
+		t.Errorf("Expected restored queue %v, got %v", []string{c, a, b}, queued)
+	}
+
+	// Clearing the queue leaves the running task
+	if cleared := r1.ClearQueue(); !slices.Equal(cleared, []string{c, a, b}) {
+		t.Errorf("Expected tasks %v to be cleared, got %v", []string{c, a, b}, cleared)
+	}
+	if status, _ := r1.TaskStatus(a); status.State != TaskCancelled {
+		t.Errorf("Expected cleared task to be cancelled, got %s", status.State)
+	}
+	if status, _ := r1.TaskStatus(running); status.State != TaskRunning {
+		t.Errorf("Expected running task to carry on, got %s", status.State)
+	}
+
+	// A task can be put at the front of the queue whatever its priority
+	high, _, _ := r1.EnqueueTask("E", WithTaskPriority(PriorityHigh))
+	front, _, _ := r1.EnqueueTask("S", WithQueueFront())
+	if queued := ids(r1.ListQueuedTasks()); !slices.Equal(queued, []string{front, high}) {
+		t.Errorf("Expected queue %v, got %v", []string{front, high}, queued)
+	}
+}
+
+func TestRobot_Pause(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock))
+	r1, _ := AddRobot(w, 0, 0, "R1")
+	events, cancel := w.Subscribe(EventRobotPaused, EventRobotResumed, EventWarehousePaused, EventWarehouseResumed)
+	defer cancel()
+	ctx, cancelWait := context.WithTimeout(context.Background(), time.Second)
+	defer cancelWait()
+
+	// Cancelling interrupts the wait for the command period
+	taskID, _, _ := r1.EnqueueTask("N N N")
+	clock.BlockUntil(1)
+	r1.CancelTask(taskID)
+	if result, err := r1.Wait(ctx, taskID); err != nil || result.State != TaskCancelled || result.CommandsExecuted != 1 {
+		t.Fatalf("Expected the task to be cancelled without advancing the clock, got %+v, %v", result, err)
+	}
+
+	// A paused robot holds after its current command, keeping its tasks
+	first, _, _ := r1.EnqueueTask("E E")
+	clock.BlockUntil(1)
+	r1.Pause()
+	r1.Pause() // Already paused
+	second, _, _ := r1.EnqueueTask("E")
+	clock.Advance(CommandExecutionTime)
+	time.Sleep(50 * time.Millisecond)
+	if waiters := clock.Waiters(); waiters != 0 {
+		t.Errorf("Expected a paused robot not to wait on the clock, got %d waiters", waiters)
+	}
+	if status, _ := r1.TaskStatus(first); status.State != TaskRunning || status.CommandsExecuted != 1 {
+		t.Errorf("Expected the running task to be held after 1 command, got %+v", status)
+	}
+
+	// A warehouse pause holds the robot until the warehouse is resumed, whatever the robot's own pause
+	w.Pause()
+	r1.Resume()
+	time.Sleep(50 * time.Millisecond)
+	if waiters := clock.Waiters(); waiters != 0 {
+		t.Errorf("Expected the robot to be held by the warehouse, got %d waiters", waiters)
+	}
+	w.Resume()
+	for range 2 {
+		clock.BlockUntil(1)
+		clock.Advance(CommandExecutionTime)
+	}
+	if result, err := r1.Wait(ctx, second); err != nil || result.State != TaskCompleted {
+		t.Errorf("Expected the queued task to complete after resuming, got %+v, %v", result, err)
+	}
+	if state := r1.CurrentState(); state.X != 3 || state.Y != 1 {
+		t.Errorf("Expected robot at (3, 1), got (%d, %d)", state.X, state.Y)
+	}
+
+	var types []EventType
+	for range 4 {
+		types = append(types, (<-events).Type)
+	}
+	expected := []EventType{EventRobotPaused, EventWarehousePaused, EventRobotResumed, EventWarehouseResumed}
+	if !slices.Equal(types, expected) {
+		t.Errorf("Expected events %v, got %v", expected, types)
+	}
+
+	// The pause state survives a journal replay and a snapshot
+	path := filepath.Join(t.TempDir(), "warehouse.journal")
+	jw := NewWarehouse(WithJournal(path, RecoverResume))
+	jr, _ := AddRobot(jw, 0, 0, "J1")
+	jw.Pause()
+	jr.Pause()
+	jw.Resume()
+	jw.Close(ctx)
+	restored := NewWarehouse(WithJournal(path, RecoverResume))
+	defer restored.Close(ctx)
+	data, _ := restored.Snapshot()
+	var snap Snapshot
+	json.Unmarshal(data, &snap)
+	if snap.Paused || len(snap.Robots) != 1 || !snap.Robots[0].Paused {
+		t.Errorf("Expected only the robot to be paused after replay, got:\n%s", data)
+	}
+	snapped, _, err := Restore(data)
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	defer snapped.Close(ctx)
+	data, _ = snapped.Snapshot()
+	snap = Snapshot{}
+	json.Unmarshal(data, &snap)
+	if snap.Paused || len(snap.Robots) != 1 || !snap.Robots[0].Paused {
+		t.Errorf("Expected only the robot to be paused after restoring, got:\n%s", data)
+	}
+}
+
+func TestWarehouse_EmergencyStop(t *testing.T) {
+	clock := newTestClock()
+	w := NewWarehouse(WithClock(clock))
+	r1, _ := AddRobot(w, 0, 0, "R1")
+	AddRobot(w, 5, 5, "R2")
+	events, cancel := w.Subscribe(EventEmergencyStop, EventTaskInterrupted, EventEmergencyReset)
+	defer cancel()
+	ctx, cancelWait := context.WithTimeout(context.Background(), time.Second)
+	defer cancelWait()
+
+	running, _, errCh := r1.EnqueueTask("N N N")
+	clock.BlockUntil(1)
+	queued, _, _ := r1.EnqueueTask("E")
+
+	// The running task stops without the clock advancing, and the state of every robot is reported
+	incident := w.EmergencyStop()
+	if len(incident.Robots) != 2 || !incident.Time.Equal(clock.Now()) {
+		t.Fatalf("Expected an incident for 2 robots, got %+v", incident)
+	}
+	expected := RobotIncident{RobotID: "R1", State: RobotState{X: 0, Y: 1}, TaskID: running, CommandsExecuted: 1, Cancelled: []string{queued}}
+	if got := incident.Robots[0]; got.RobotID != expected.RobotID || got.State != expected.State || got.TaskID != expected.TaskID ||
+		got.CommandsExecuted != expected.CommandsExecuted || !slices.Equal(got.Cancelled, expected.Cancelled) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+	if got := incident.Robots[1]; got.RobotID != "R2" || got.TaskID != "" || got.State != (RobotState{X: 5, Y: 5}) {
+		t.Errorf("Unexpected incident for R2: %+v", got)
+	}
+	if result, err := r1.Wait(ctx, running); err != nil || result.State != TaskInterrupted || result.Err != ErrEmergencyStop {
+		t.Errorf("Expected the running task to be interrupted, got %+v, %v", result, err)
+	}
+	var lastErr error
+	for err := range errCh {
+		lastErr = err
+	}
+	if lastErr != ErrEmergencyStop {
+		t.Errorf("Expected %v on the error channel, got %v", ErrEmergencyStop, lastErr)
+	}
+	if status, _ := r1.TaskStatus(queued); status.State != TaskCancelled {
+		t.Errorf("Expected the queued task to be cancelled, got %s", status.State)
+	}
+
+	// New tasks are rejected until the stop is reset
+	if taskID, _, errCh := r1.EnqueueTask("E"); taskID != "" || <-errCh != ErrEmergencyStop {
+		t.Errorf("Expected the task to be rejected with %v", ErrEmergencyStop)
+	}
+	if again := w.EmergencyStop(); !again.Time.Equal(incident.Time) || len(again.Robots) != 2 {
+		t.Errorf("Expected stopping again to return the first incident, got %+v", again)
+	}
+	if report, ok := w.Incident(); !ok || report.Robots[0].TaskID != running {
+		t.Errorf("Expected the incident report while stopped, got %+v, %v", report, ok)
+	}
+
+	// The stop survives a snapshot
+	data, _ := w.Snapshot()
+	restored, robots, err := Restore(data, WithClock(newTestClock()))
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if report, ok := restored.Incident(); !ok || len(report.Robots) != 2 {
+		t.Errorf("Expected the restored warehouse to be stopped, got %+v, %v", report, ok)
+	}
+	if taskID, _, _ := robots["R1"].EnqueueTask("E"); taskID != "" {
+		t.Error("Expected the restored warehouse to reject tasks")
+	}
+
+	w.Reset()
+	w.Reset() // Not stopped
+	if _, ok := w.Incident(); ok {
+		t.Error("Expected no incident after reset")
+	}
+	taskID, _, _ := r1.EnqueueTask("E")
+	clock.BlockUntil(1)
+	clock.Advance(CommandExecutionTime)
+	if result, err := r1.Wait(ctx, taskID); err != nil || result.State != TaskCompleted {
+		t.Errorf("Expected a task to complete after reset, got %+v, %v", result, err)
+	}
+
+	var types []EventType
+	for range 3 {
+		types = append(types, (<-events).Type)
+	}
+	if expected := []EventType{EventEmergencyStop, EventTaskInterrupted, EventEmergencyReset}; !slices.Equal(types, expected) {
+		t.Errorf("Expected events %v, got %v", expected, types)
+	}
+
+	// The stop survives a journal replay
+	path := filepath.Join(t.TempDir(), "warehouse.journal")
+	jw := NewWarehouse(WithJournal(path, RecoverResume))
+	AddRobot(jw, 2, 2, "J1")
+	jw.EmergencyStop()
+	jw.Close(ctx)
+	replayed := NewWarehouse(WithJournal(path, RecoverResume))
+	defer replayed.Close(ctx)
+	if report, ok := replayed.Incident(); !ok || len(report.Robots) != 1 || report.Robots[0].State != (RobotState{X: 2, Y: 2}) {
+		t.Errorf("Expected the replayed warehouse to be stopped, got %+v, %v", report, ok)
+	}
+}
+
+// TestRobot_Battery checks moves use charge, a depleted robot stops and chargers fill its battery
+func TestRobot_Battery(t *testing.T) {
+	clock := newTestClock()
+	model := BatteryModel{Capacity: 10, MoveCost: 2, DiagonalMoveCost: 3, CarryCost: 1}
+	cw := NewCrateWarehouse(WithClock(clock), WithBattery(model))
+	events, cancel := cw.Subscribe(EventChargerAdded, EventChargerRemoved, EventRobotCharged)
+	defer cancel()
+	if got, ok := cw.Battery(); !ok || got != model {
+		t.Errorf("Expected battery model %+v, got %+v, %v", model, got, ok)
+	}
+
+	if err := cw.AddCharger(0, 0); err != nil {
+		t.Fatalf("Failed to add charger: %v", err)
+	}
+	if err := cw.AddCharger(0, 0); err != ErrChargerExists {
+		t.Errorf("Expected %v adding charger twice, got %v", ErrChargerExists, err)
+	}
+	if err := cw.AddObstacle(0, 0); err != ErrChargerExists {
+		t.Errorf("Expected %v adding obstacle on a charger, got %v", ErrChargerExists, err)
+	}
+	cw.AddObstacle(5, 5)
+	if err := cw.AddCharger(5, 5); err != ErrObstacle {
+		t.Errorf("Expected %v adding charger on an obstacle, got %v", ErrObstacle, err)
+	}
+	cw.AddCharger(9, 9)
+	if err := cw.DelCharger(9, 9); err != nil {
+		t.Errorf("Failed to delete charger: %v", err)
+	}
+	if err := cw.DelCharger(9, 9); err != ErrChargerNotFound {
+		t.Errorf("Expected %v deleting charger twice, got %v", ErrChargerNotFound, err)
+	}
+	if chargers := cw.Chargers(); !slices.Equal(chargers, []Position{{0, 0}}) {
+		t.Errorf("Expected a charger at (0,0), got %v", chargers)
+	}
+
+	cw.AddCrate(0, 1)
+	r, _ := AddRobot(cw, 0, 0, "R1")
+	if state := r.CurrentState(); state.Battery != model.Capacity {
+		t.Errorf("Expected a full battery, got %d", state.Battery)
+	}
+
+	// Each move uses charge, and more while carrying a crate, until the robot cannot make its next move
+	sim, err := r.Simulate("N G N S S")
+	if err != ErrBatteryDepleted || sim.FailedIndex != 4 || sim.Final.Battery != 2 {
+		t.Errorf("Expected simulation to run out of charge on the last move, got %+v, %v", sim, err)
+	}
+	_, _, errCh := r.EnqueueTask("N G N S S")
+	for range 4 {
+		clock.BlockUntil(1)
+		clock.Advance(CommandExecutionTime)
+	}
+	if err := <-errCh; err != ErrBatteryDepleted {
+		t.Errorf("Expected %v, got %v", ErrBatteryDepleted, err)
+	}
+	if state := r.CurrentState(); state != (RobotState{X: 0, Y: 1, HasCrate: true, Battery: 2}) {
+		t.Errorf("Expected the robot to stop at (0,1) with 2 charge left, got %+v", state)
+	}
+	// An invalid move is reported as such, even when there is not enough charge to make it
+	if _, err := r.Simulate("W"); err != ErrOutOfBounds {
+		t.Errorf("Expected simulation to report %v before charge, got %v", ErrOutOfBounds, err)
+	}
+	_, _, errCh = r.EnqueueTask("W")
+	if err := <-errCh; err != ErrOutOfBounds {
+		t.Errorf("Expected %v before charge, got %v", ErrOutOfBounds, err)
+	}
+	if _, _, errCh := r.EnqueueTask("C"); <-errCh != ErrNotOnCharger {
+		t.Errorf("Expected %v charging away from a charger", ErrNotOnCharger)
+	}
+
+	// Battery levels and chargers survive a snapshot
+	data, _ := cw.Snapshot()
+	restored, robots, err := Restore(data, WithClock(newTestClock()), WithBattery(model))
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if state := robots["R1"].CurrentState(); state.Battery != 2 || !slices.Equal(restored.Chargers(), cw.Chargers()) {
+		t.Errorf("Expected R1 restored with 2 charge beside its charger, got %+v, %v", state, restored.Chargers())
+	}
+
+	// Back on the charger, the battery is filled
+	_, _, errCh = r.EnqueueTask("D S C")
+	for range 3 {
+		clock.BlockUntil(1)
+		clock.Advance(CommandExecutionTime)
+	}
+	for err := range errCh {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if state := r.CurrentState(); state.Battery != model.Capacity {
+		t.Errorf("Expected a full battery after charging, got %d", state.Battery)
+	}
+	var types []EventType
+	for range 4 {
+		types = append(types, (<-events).Type)
+	}
+	expected := []EventType{EventChargerAdded, EventChargerAdded, EventChargerRemoved, EventRobotCharged}
+	if !slices.Equal(types, expected) {
+		t.Errorf("Expected events %v, got %v", expected, types)
+	}
+
+	// Render draws the charger under the robot and lists its battery by full ID, still as a text layout
+	var buf bytes.Buffer
+	stdout := os.Stdout
+	pr, pw, _ := os.Pipe()
+	os.Stdout = pw
+	Render(cw, nil)
+	pw.Close()
+	os.Stdout = stdout
+	buf.ReadFrom(pr)
+	rendered, err := ParseLayout(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse rendered layout: %v\n%s", err, buf.String())
+	}
+	if len(rendered.Chargers) != 1 || len(rendered.Robots) != 1 {
+		t.Errorf("Expected the rendered layout to hold the charger and robot, got %+v", rendered)
+	}
+	if !strings.Contains(buf.String(), "--- Battery: R1 10\n") {
+		t.Errorf("Expected the rendered view to list R1's battery, got\n%s", buf.String())
+	}
+
+	// Layouts set the starting charge
+	l, err := ParseLayout([]byte("[+] - R2\nbattery R2 4\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse text layout: %v", err)
+	}
+	_, layoutRobots, err := LoadLayout(l, WithClock(newTestClock()), WithBattery(model))
+	if err != nil {
+		t.Fatalf("Failed to load layout: %v", err)
+	}
+	if state := layoutRobots["R2"].CurrentState(); state.Battery != 4 {
+		t.Errorf("Expected R2 to start with 4 charge, got %d", state.Battery)
+	}
+	if _, err := ParseLayout([]byte(" - R2\nbattery R3 4")); !errors.Is(err, ErrInvalidLayout) {
+		t.Errorf("Expected %v for the battery of a robot not on the grid, got %v", ErrInvalidLayout, err)
+	}
+}
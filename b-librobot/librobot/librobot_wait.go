@@ -0,0 +1,86 @@
+package librobot
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Context-aware task submission, and waiting for tasks to finish
+
+// TaskResult is the outcome of a finished task, as returned by Robot.Wait.
+type TaskResult struct {
+	ID               string
+	State            TaskState     // TaskCompleted, TaskFailed, TaskCancelled or TaskInterrupted
+	FinalState       RobotState    // State of the robot when the task finished
+	CommandsExecuted int           // Number of commands executed successfully
+	Duration         time.Duration // Time from the robot starting the task to its end; zero if cancelled while queued
+	Err              error         // Error which ended the task, if failed, cancelled or interrupted
+}
+
+// EnqueueTaskContext adds a new task to the robot's queue as for EnqueueTask. If the context is done before the task
+// finishes, the task is cancelled. A context which is already done is reported like an invalid command string:
+// the task ID is empty and the context's error is sent on the error channel.
+func (r *robotImpl) EnqueueTaskContext(ctx context.Context, commands string, opts ...TaskOption) (taskID string, position chan RobotState, err chan error) {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		log.Printf("Robot %s: Rejected task \"%s\": %v", r.id, commands, ctxErr)
+		position, err = make(chan RobotState), make(chan error, 1)
+		err <- ctxErr
+		close(err)
+		close(position)
+		return "", position, err
+	}
+
+	task, position, err := r.enqueueTask(commands, opts)
+	if task == nil {
+		return "", position, err
+	}
+	taskID = task.id
+	if ctx.Done() == nil {
+		return taskID, position, err
+	}
+
+	// The task's record may be pruned as soon as it finishes, so watch the task itself
+	done := task.done
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Printf("Robot %s: Task %s context done: %v", r.id, taskID, ctx.Err())
+			r.CancelTask(taskID) // The task may have finished in the meantime
+		case <-done:
+		}
+	}()
+	return taskID, position, err
+}
+
+// Wait blocks until the task has finished, and returns its result. The task's own error is in the result.
+// It returns ErrTaskNotFound if the robot has no record of the task, or the context's error if the context is done first.
+func (r *robotImpl) Wait(ctx context.Context, taskID string) (TaskResult, error) {
+	r.mu.Lock()
+	r.pruneTasks()
+	task, ok := r.tasks[taskID]
+	r.mu.Unlock()
+	if !ok {
+		return TaskResult{}, ErrTaskNotFound
+	}
+
+	select {
+	case <-task.done:
+	case <-ctx.Done():
+		return TaskResult{}, ctx.Err()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := TaskResult{
+		ID:               task.id,
+		State:            task.state,
+		FinalState:       task.final,
+		CommandsExecuted: task.executed,
+		Err:              task.err,
+	}
+	if !task.startedAt.IsZero() {
+		result.Duration = task.endedAt.Sub(task.startedAt)
+	}
+	return result, nil
+}
@@ -4,8 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid" // Create unique identifier for each warehouse, robot
 )
@@ -13,30 +16,87 @@ import (
 // An implementation of the warehouse for simulation purposes
 // Provides options to override interface with alternative implementations later
 
+// WarehouseOption configures a warehouse when it is created.
+type WarehouseOption func(*warehouseImpl)
+
+// WithClock sets the clock used to pace robot commands. The default is a real time clock.
+func WithClock(c Clock) WarehouseOption {
+	return func(w *warehouseImpl) {
+		w.clock = c
+	}
+}
+
+// WithTaskRetention sets how long finished tasks are kept for Robot.TaskStatus. The default is DefaultTaskRetention.
+func WithTaskRetention(d time.Duration) WarehouseOption {
+	return func(w *warehouseImpl) {
+		w.taskRetention = d
+	}
+}
+
+// WithGridSize sets the dimensions of the warehouse grid. The default is GridSize x GridSize.
+// Coordinates range from 0 to width-1 and 0 to height-1. Zero dimensions are ignored.
+func WithGridSize(width, height uint) WarehouseOption {
+	return func(w *warehouseImpl) {
+		if width > 0 && height > 0 {
+			w.width, w.height = width, height
+		}
+	}
+}
+
 // NewWarehouse creates and returns a new simulated Warehouse instance.
-// The warehouse grid dimensions are defined by GridSize.
-func NewWarehouse() Warehouse {
+// The warehouse grid dimensions default to GridSize and can be changed with WithGridSize.
+func NewWarehouse(opts ...WarehouseOption) Warehouse {
 	w := &warehouseImpl{
-		robots:     make(map[string]*robotImpl),
-		gridyx:     [GridSize + 1][GridSize + 1]string{}, // Initialize with empty strings
-		mu:         &sync.RWMutex{},                      // Controls access to changing settings so only one at a time
-		has_crates: false,
+		robots:          make(map[string]*robotImpl),
+		mu:              &sync.RWMutex{}, // Controls access to changing settings so only one at a time
+		has_crates:      false,
+		clock:           NewRealClock(),
+		width:           GridSize,
+		height:          GridSize,
+		taskRetention:   DefaultTaskRetention,
+		queueCapacity:   DefaultQueueCapacity,
+		events:          newEventBus(),
+		collisionPolicy: AbortOnCollision(),
+		deadlocks:       newDeadlockDetector(),
+		locations:       make(map[string]Position),
+		shutdown:        ShutdownCancel,
+	}
+	for _, opt := range opts {
+		opt(w)
 	}
-	log.Println("New Warehouse created.")
+	w.initGrid()
+	w.epoch = w.clock.Now()
+	w.openJournal()
+	log.Printf("New Warehouse created (%dx%d).", w.width, w.height)
 	return w
 }
 
 // NewCrateWarehouse creates a new warehouse with no robots. This warehouse can accept crates
 // This function now returns the new CrateWarehouse interface.
-func NewCrateWarehouse() CrateWarehouse {
+func NewCrateWarehouse(opts ...WarehouseOption) CrateWarehouse {
 	cw := &warehouseImpl{
 		robots: make(map[string]*robotImpl),
-		gridyx: [GridSize + 1][GridSize + 1]string{}, // Initialize with empty strings
-		mu:     &sync.RWMutex{},                      // Controls access to changing settings so only one at a time
+		mu:     &sync.RWMutex{}, // Controls access to changing settings so only one at a time
 		// cratesyx defaults to false
-		has_crates: true,
+		has_crates:      true,
+		clock:           NewRealClock(),
+		width:           GridSize,
+		height:          GridSize,
+		taskRetention:   DefaultTaskRetention,
+		queueCapacity:   DefaultQueueCapacity,
+		events:          newEventBus(),
+		collisionPolicy: AbortOnCollision(),
+		deadlocks:       newDeadlockDetector(),
+		locations:       make(map[string]Position),
+		shutdown:        ShutdownCancel,
+	}
+	for _, opt := range opts {
+		opt(cw)
 	}
-	log.Println("New Crate Warehouse created.")
+	cw.initGrid()
+	cw.epoch = cw.clock.Now()
+	cw.openJournal()
+	log.Printf("New Crate Warehouse created (%dx%d).", cw.width, cw.height)
 	return cw
 }
 
@@ -46,10 +106,58 @@ type warehouseImpl struct {
 	robots map[string]*robotImpl
 	// Gridyx stores the ID of the robot occupying a cell, or an empty string if vacant.
 	// gridyx[y][x] for easier access: grid[row][column]
-	gridyx     [GridSize + 1][GridSize + 1]string
-	mu         *sync.RWMutex                    // Mutex to protect access to robots and grid
-	cratesyx   [GridSize + 1][GridSize + 1]bool // 2D array of crate locations. Refactor if warehouse can be huge for memory optimisation
-	has_crates bool
+	gridyx      [][]string
+	mu          *sync.RWMutex // Mutex to protect access to robots and grid
+	cratesyx    [][]bool      // 2D array of crate locations. Refactor if warehouse can be huge for memory optimisation
+	obstaclesyx [][]bool      // 2D array of impassable cells
+	chargersyx  [][]bool      // 2D array of charger cells
+	has_crates  bool
+	clock       Clock // Simulation clock used to pace robot commands
+	width       uint  // Number of columns in the grid; x ranges from 0 to width-1
+	height      uint  // Number of rows in the grid; y ranges from 0 to height-1
+
+	taskRetention   time.Duration       // How long finished tasks are kept for status reporting
+	queueCapacity   int                 // Number of tasks which may wait in each robot's queue
+	events          *eventBus           // Delivers state changes to subscribers
+	collisionPolicy CollisionPolicy     // How robots respond to blocked moves, unless overridden per robot
+	reservations    *reservationTable   // Space-time cell reservations; nil unless enabled with WithReservations
+	epoch           time.Time           // Clock time the warehouse was created; tick 0 of the reservation table
+	deadlocks       *deadlockDetector   // Wait-for graph of robots blocked by other robots
+	locations       map[string]Position // Named cells, set by LoadLayout
+	journalPath     string              // Path of the journal; empty unless enabled with WithJournal
+	recovery        RecoveryPolicy      // How tasks which had started are recovered from the journal
+	journal         *journal            // Open journal, or nil
+	shutdown        ShutdownPolicy      // What Close does with pending tasks
+	closed          atomic.Bool         // Set by Close; no more robots or tasks are accepted
+	pause           pauseGate           // Holds every robot between commands while the warehouse is paused
+	battery         *BatteryModel       // Charge used by robots; nil unless enabled with WithBattery
+
+	// Incident report set by EmergencyStop until Reset; no tasks are accepted while it is set
+	incident atomic.Pointer[Incident]
+}
+
+// initGrid allocates the robot, crate, obstacle and charger grids for the warehouse dimensions.
+func (w *warehouseImpl) initGrid() {
+	w.gridyx = make([][]string, w.height)
+	w.cratesyx = make([][]bool, w.height)
+	w.obstaclesyx = make([][]bool, w.height)
+	w.chargersyx = make([][]bool, w.height)
+	for y := range w.gridyx {
+		w.gridyx[y] = make([]string, w.width) // Initialize with empty strings
+		w.cratesyx[y] = make([]bool, w.width)
+		w.obstaclesyx[y] = make([]bool, w.width)
+		w.chargersyx[y] = make([]bool, w.width)
+	}
+}
+
+// inBounds reports whether the coordinates lie within the warehouse grid.
+func (w *warehouseImpl) inBounds(x, y uint) bool {
+	return x < w.width && y < w.height
+}
+
+// Size returns the width and height of the warehouse grid.
+func (w *warehouseImpl) Size() (width, height uint) {
+	return w.width, w.height
 }
 
 // Robots returns a list of all robots currently in the warehouse.
@@ -79,13 +187,19 @@ func AddRobot(w Warehouse, initialX, initialY uint, namedID string) (Robot, erro
 	wh.mu.Lock()
 	defer wh.mu.Unlock()
 
-	// Check desired initial position is within the specified grid size (10x10 default)
-	if initialX > GridSize || initialY > GridSize {
+	if wh.closed.Load() {
+		return nil, ErrWarehouseClosed
+	}
+	// Check desired initial position is within the warehouse grid (10x10 default)
+	if !wh.inBounds(initialX, initialY) {
 		return nil, errors.New("error: initial X and Y are out of bounds")
 	}
 	if wh.gridyx[initialY][initialX] != "" {
 		return nil, errors.New("error: a robot exists at this positin")
 	}
+	if wh.isObstacle(initialX, initialY) {
+		return nil, ErrObstacle
+	}
 
 	robotID := ""
 
@@ -97,21 +211,14 @@ func AddRobot(w Warehouse, initialX, initialY uint, namedID string) (Robot, erro
 		robotID = namedID
 	}
 	// Create robot with defaults
-	robot := &robotImpl{
-		id:             robotID,
-		warehouse:      wh,
-		state:          RobotState{X: initialX, Y: initialY, HasCrate: false},
-		canPickCrates:  isCrateWarehouse,
-		taskQueue:      make(chan *robotTask, 100),     // Buffered channel for tasks
-		cancelChannels: make(map[string]chan struct{}), // Initialise
-		mu:             &sync.Mutex{},
-		stopWorker:     make(chan struct{}),
-	}
+	robot := wh.newRobot(robotID, initialX, initialY, isCrateWarehouse)
 
 	// Add robot to list robots in this warehouse
 	wh.robots[robotID] = robot
 	// Add robot to grid
 	wh.gridyx[initialY][initialX] = robotID
+	wh.publish(Event{Type: EventRobotAdded, RobotID: robotID, X: initialX, Y: initialY, State: robot.state})
+	robot.recordRobot()
 
 	// Start worker
 	go robot.startWorker()
@@ -119,6 +226,24 @@ func AddRobot(w Warehouse, initialX, initialY uint, namedID string) (Robot, erro
 	return robot, nil
 }
 
+// newRobot creates a robot with default settings at the given position.
+// It does not add the robot to the warehouse or start its worker.
+func (w *warehouseImpl) newRobot(robotID string, x, y uint, canPickCrates bool) *robotImpl {
+	return &robotImpl{
+		id:             robotID,
+		warehouse:      w,
+		state:          RobotState{X: x, Y: y, HasCrate: false, Battery: w.battery.capacity()},
+		canPickCrates:  canPickCrates,
+		wake:           make(chan struct{}, 1),         // Wakes the worker when a task is queued
+		cancelChannels: make(map[string]chan struct{}), // Initialise
+		mu:             &sync.Mutex{},
+		stopWorker:     make(chan struct{}),
+		workerDone:     make(chan struct{}),
+		tasks:          make(map[string]*robotTask),
+		deadlock:       make(chan DeadlockStrategy, 1),
+	}
+}
+
 // AddDiagonalRobot adds a new robot to the warehouse at the specified initial coordinates.
 // This robot has the capability to move diagonally in the grid when coordinates are in the correct sequence.
 // It returns the new Robot instance and an error if the position is invalid or occupied.
@@ -135,13 +260,19 @@ func AddDiagonalRobot(w Warehouse, initialX, initialY uint, namedID string) (Rob
 	wh.mu.Lock()
 	defer wh.mu.Unlock()
 
-	// Check desired initial position is within the specified grid size (10x10 default)
-	if initialX > GridSize || initialY > GridSize {
+	if wh.closed.Load() {
+		return nil, ErrWarehouseClosed
+	}
+	// Check desired initial position is within the warehouse grid (10x10 default)
+	if !wh.inBounds(initialX, initialY) {
 		return nil, ErrOutOfBounds
 	}
 	if wh.gridyx[initialY][initialX] != "" {
 		return nil, ErrPositionOccupied
 	}
+	if wh.isObstacle(initialX, initialY) {
+		return nil, ErrObstacle
+	}
 	robotID := ""
 	// Use named ID if given; if not, use UUID
 	if namedID == "" {
@@ -152,22 +283,15 @@ func AddDiagonalRobot(w Warehouse, initialX, initialY uint, namedID string) (Rob
 	}
 
 	// Create robot with defaults
-	robot := &robotImpl{
-		id:             robotID,
-		warehouse:      wh,
-		state:          RobotState{X: initialX, Y: initialY, HasCrate: false},
-		canPickCrates:  isCrateWarehouse,
-		taskQueue:      make(chan *robotTask, 100),     // Buffered channel for tasks
-		cancelChannels: make(map[string]chan struct{}), // Initialise
-		mu:             &sync.Mutex{},
-		stopWorker:     make(chan struct{}),
-		isDiagonal:     true,
-	}
+	robot := wh.newRobot(robotID, initialX, initialY, isCrateWarehouse)
+	robot.isDiagonal = true
 
 	// Add robot to list robots in this warehouse
 	wh.robots[robotID] = robot
 	// Add robot to grid
 	wh.gridyx[initialY][initialX] = robotID
+	wh.publish(Event{Type: EventRobotAdded, RobotID: robotID, X: initialX, Y: initialY, State: robot.state})
+	robot.recordRobot()
 
 	// Start worker
 	go robot.startWorker()
@@ -184,15 +308,20 @@ func (cw *warehouseImpl) AddCrate(x uint, y uint) error {
 	cw.mu.Lock()
 	defer cw.mu.Unlock()
 
-	if x > GridSize || y > GridSize {
+	if !cw.inBounds(x, y) {
 		return ErrCrateOutOfBounds
 	}
 	// Check for a crate with a direct array lookup.
 	if cw.cratesyx[y][x] {
 		return ErrCrateExists
 	}
+	if cw.isObstacle(x, y) {
+		return ErrObstacle
+	}
 	cw.cratesyx[y][x] = true
 	log.Printf("Crate added at (%d, %d).", x, y)
+	cw.publish(Event{Type: EventCrateAdded, X: x, Y: y})
+	cw.record(journalEntry{Op: journalCrateAdd, X: x, Y: y})
 	return nil
 }
 
@@ -205,7 +334,7 @@ func (cw *warehouseImpl) DelCrate(x uint, y uint) error {
 	cw.mu.Lock()
 	defer cw.mu.Unlock()
 
-	if x > GridSize || y > GridSize {
+	if !cw.inBounds(x, y) {
 		return ErrCrateOutOfBounds
 	}
 	// Check for a crate with a direct array lookup.
@@ -214,6 +343,8 @@ func (cw *warehouseImpl) DelCrate(x uint, y uint) error {
 	}
 	cw.cratesyx[y][x] = false
 	log.Printf("Crate deleted from (%d, %d).", x, y)
+	cw.publish(Event{Type: EventCrateRemoved, X: x, Y: y})
+	cw.record(journalEntry{Op: journalCrateDel, X: x, Y: y})
 	return nil
 }
 
@@ -225,6 +356,7 @@ func ClearScreen() {
 }
 
 // Render draws the current state of the warehouse. It does not explicity clear screen
+// If robots have batteries, their charge is listed by full ID on a line below the grid, which ParseLayout skips.
 func Render(w CrateWarehouse, robot_map map[string]Robot) {
 	// Retrieve warehouse implementation
 	wh, ok := w.(*warehouseImpl)
@@ -232,12 +364,25 @@ func Render(w CrateWarehouse, robot_map map[string]Robot) {
 		return
 	}
 
+	// Copy the robots, as they may be added or removed while the grid is drawn
+	wh.mu.RLock()
+	states := make(map[string]RobotState, len(wh.robots))
+	for id, robot := range wh.robots {
+		states[id] = robot.CurrentState()
+	}
+
 	// Create a 2D array to represent the grid
-	grid := make([][]string, GridSize)
+	grid := make([][]string, wh.height)
 	for i := range grid {
-		grid[i] = make([]string, GridSize)
+		grid[i] = make([]string, wh.width)
 		for j := range grid[i] {
 			grid[i][j] = " - " // Default empty space
+			if wh.obstaclesyx[i][j] {
+				grid[i][j] = "###"
+			}
+			if wh.chargersyx[i][j] {
+				grid[i][j] = layoutCharger
+			}
 
 			// Check crate and Add it
 			if wh.has_crates {
@@ -249,33 +394,49 @@ func Render(w CrateWarehouse, robot_map map[string]Robot) {
 	}
 
 	// Place robots on the grid (overwriting crates if necessary)
-	for id, robot := range wh.robots {
-		state := robot.CurrentState()
-		if state.Y < GridSize && state.X < GridSize {
+	for id, state := range states {
+		if wh.inBounds(state.X, state.Y) {
 			label := id
 			//symbol := fmt.Sprintf("R%d ", i) // e.g., "R0 "
-			symbol := label[0:2]
+			symbol := label[:min(2, len(label))]
 			if state.HasCrate {
 				//symbol = fmt.Sprintf("R%d*", i) // e.g., "R0*"
 				symbol += "*"
 			} else if wh.cratesyx[state.Y][state.X] {
 				symbol += "_"
+			} else if wh.chargersyx[state.Y][state.X] {
+				symbol += "+"
 			}
 			grid[state.Y][state.X] = symbol
 		}
 	}
+	wh.mu.RUnlock()
 
 	// Build the output string and print
 	var builder strings.Builder
 	builder.WriteString("--- Warehouse Real-Time View ---\n")
 	// Display grid, with 0,0 as the bottom left corner for good UX
-	for y := int(GridSize - 1); y >= 0; y-- {
-		for x := uint(0); x < GridSize; x++ {
+	for y := int(wh.height) - 1; y >= 0; y-- {
+		for x := uint(0); x < wh.width; x++ {
 			builder.WriteString(grid[y][x])
 		}
 		builder.WriteString("\n")
 	}
 	builder.WriteString("--------------------------------\n")
+	// Battery levels. Robots may share a two character label, so these are not battery directives; the line
+	// starts with "---" so the view can still be parsed as a layout.
+	if wh.battery != nil && len(states) > 0 {
+		ids := make([]string, 0, len(states))
+		for id := range states {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		builder.WriteString("--- Battery:")
+		for _, id := range ids {
+			fmt.Fprintf(&builder, " %s %d", id, states[id].Battery)
+		}
+		builder.WriteString("\n")
+	}
 	//builder.WriteString("Enter command >>.\n")
 	fmt.Print(builder.String())
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -20,7 +21,9 @@ import (
 var (
 	warehouse      librobot.CrateWarehouse
 	done           chan bool
+	viewStopped    chan struct{} // Closed by the view goroutine once it has stopped writing
 	simulationTick = 200 * time.Millisecond
+	closeTimeout   = 5 * time.Second // How long robots are given to stop when the CLI exits
 	robot_map      map[string]librobot.Robot
 	viewIsRunning  bool
 )
@@ -89,14 +92,58 @@ var addDiagRobotCmd = &cobra.Command{
 	},
 }
 
+// removeRobotCmd represents the remove_robot command
+var removeRobotCmd = &cobra.Command{
+	Use:   "remove_robot [robot_id] [drain] [drop_crate]",
+	Short: "Remove a robot from the warehouse",
+	Long: `Remove a robot from the warehouse. Its tasks are cancelled, unless 'drain' is given,
+in which case the robot finishes them first. A robot carrying a crate is only removed
+if 'drop_crate' is given, and drops the crate where it stands.`,
+	Args: cobra.RangeArgs(1, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		robotID := args[0]
+		var policy librobot.RemovalPolicy
+		for _, option := range args[1:] {
+			switch option {
+			case "drain":
+				policy.Drain = true
+			case "drop_crate":
+				policy.DropCrate = true
+			default:
+				fmt.Printf("Error: Unknown option '%s'. Use 'drain' or 'drop_crate'.\n", option)
+				return
+			}
+		}
+
+		if _, ok := robot_map[robotID]; !ok {
+			fmt.Printf("Error: Robot with ID '%s' not found.\n", robotID)
+			return
+		}
+		if err := librobot.RemoveRobot(warehouse, robotID, policy); err != nil {
+			fmt.Printf("Error removing robot: %v %v\n", robotID, err)
+			return
+		}
+		delete(robot_map, robotID)
+		fmt.Printf("Removed robot '%s'.\n", robotID)
+	},
+}
+
 // addTaskCmd represents the add_task command
 var addTaskCmd = &cobra.Command{
-	Use:   "add_task [robot_id] [commands]",
+	Use:   "add_task [robot_id] [commands] [priority=<n>] [preempt=<suspend|abort>] [front=true]",
 	Short: "Enqueue a task for a robot",
-	Args:  cobra.MinimumNArgs(2),
+	Long: `Enqueue a task for a robot. Tasks with a higher priority run first; the default priority is 0.
+With preempt=suspend or preempt=abort, the task also suspends or aborts a running task of lower priority.
+With front=true, the task goes to the front of the queue whatever its priority.`,
+	Args: cobra.MinimumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		robotID := args[0]
-		commands := strings.Join(args[1:], "")
+		commandArgs, opts, err := parseTaskOptions(args[1:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		commands := strings.Join(commandArgs, "")
 
 		// Get robot from map
 		robot, ok := robot_map[robotID]
@@ -106,17 +153,110 @@ var addTaskCmd = &cobra.Command{
 			return
 		}
 
-		taskID, _, errChan := robot.EnqueueTask(commands)
+		taskID, _, errChan := robot.EnqueueTask(commands, opts...)
+		if taskID == "" {
+			// The commands were rejected before the task was queued
+			fmt.Printf("Error: Task rejected for robot '%s': %v\n", robotID, <-errChan)
+			return
+		}
 		fmt.Printf("Task '%s' enqueued for robot '%s'.\n", taskID, robotID)
 
-		// Listen for task completion/errors in a non-blocking way
-		go func() {
-			for err, ok := <-errChan; ok; err, ok = <-errChan {
-				if err != nil {
-					fmt.Printf("Task '%s' for robot '%s' failed: %v\n", taskID, robotID, err)
-				}
+		// Report a failure in the background
+		go reportFailure(robot, robotID, taskID)
+	},
+}
+
+// parseTaskOptions separates the trailing priority=<n>, preempt=<mode> and front=<bool> options of add_task from its commands
+func parseTaskOptions(args []string) ([]string, []librobot.TaskOption, error) {
+	var opts []librobot.TaskOption
+	for len(args) > 0 {
+		name, value, ok := strings.Cut(args[len(args)-1], "=")
+		if !ok {
+			break
+		}
+		switch name {
+		case "priority":
+			priority, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid priority '%s'. Please use an integer", value)
 			}
-		}()
+			opts = append(opts, librobot.WithTaskPriority(librobot.TaskPriority(priority)))
+		case "preempt":
+			mode := librobot.PreemptionMode(value)
+			if mode != librobot.PreemptSuspend && mode != librobot.PreemptAbort {
+				return nil, nil, fmt.Errorf("unknown preemption mode '%s'. Use 'suspend' or 'abort'", value)
+			}
+			opts = append(opts, librobot.WithPreemption(mode))
+		case "front":
+			front, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid front '%s'. Use 'true' or 'false'", value)
+			}
+			if front {
+				opts = append(opts, librobot.WithQueueFront())
+			}
+		default:
+			return nil, nil, fmt.Errorf("unknown option '%s'. Use 'priority', 'preempt' or 'front'", name)
+		}
+		args = args[:len(args)-1]
+	}
+	if len(args) == 0 {
+		return nil, nil, fmt.Errorf("no commands given")
+	}
+	return args, opts, nil
+}
+
+// reportFailure waits for a task to finish and prints its error if it did not complete
+func reportFailure(robot librobot.Robot, robotID, taskID string) {
+	result, err := robot.Wait(context.Background(), taskID)
+	if err == nil && result.Err != nil {
+		fmt.Printf("Task '%s' for robot '%s' failed: %v\n", taskID, robotID, result.Err)
+	}
+}
+
+// moveToCmd represents the move_to command
+var moveToCmd = &cobra.Command{
+	Use:   "move_to [robot_id] [x] [y] | move_to [robot_id] [location]",
+	Short: "Plan a path for a robot to a position and enqueue it as a task",
+	Args:  cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		robotID := args[0]
+		var x, y int
+		if len(args) == 2 {
+			// Named location from the loaded map
+			loc, ok := warehouse.Locations()[args[1]]
+			if !ok {
+				fmt.Printf("Error: Location '%s' not found.\n", args[1])
+				return
+			}
+			x, y = int(loc.X), int(loc.Y)
+		} else {
+			var errX, errY error
+			x, errX = strconv.Atoi(args[1])
+			y, errY = strconv.Atoi(args[2])
+			if errX != nil || errY != nil {
+				fmt.Println("Error: Invalid coordinates. Please use integers.")
+				return
+			}
+		}
+
+		// Get robot from map
+		robot, ok := robot_map[robotID]
+
+		if !ok {
+			fmt.Printf("Error: Robot with ID '%s' not found.\n", robotID)
+			return
+		}
+
+		taskID, commands, _, errChan := robot.MoveTo(uint(x), uint(y))
+		if taskID == "" {
+			fmt.Printf("Error: No path for robot '%s' to (%d, %d): %v\n", robotID, x, y, <-errChan)
+			return
+		}
+		fmt.Printf("Task '%s' enqueued for robot '%s' with commands \"%s\".\n", taskID, robotID, commands)
+
+		// Report a failure in the background
+		go reportFailure(robot, robotID, taskID)
 	},
 }
 
@@ -159,6 +299,138 @@ var delCrateCmd = &cobra.Command{
 	},
 }
 
+// addChargerCmd represents the add_charger command
+var addChargerCmd = &cobra.Command{
+	Use:   "add_charger [x] [y]",
+	Short: "Add a charger, where robots can recharge their batteries, to the warehouse",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		x, errX := strconv.Atoi(args[0])
+		y, errY := strconv.Atoi(args[1])
+		if errX != nil || errY != nil {
+			fmt.Println("Error: Invalid coordinates. Please use integers.")
+			return
+		}
+
+		if err := warehouse.AddCharger(uint(x), uint(y)); err != nil {
+			fmt.Printf("Error adding charger: %v\n", err)
+			return
+		}
+		fmt.Printf("Charger added at (%d, %d).\n", x, y)
+	},
+}
+
+// delChargerCmd represents the del_charger command
+var delChargerCmd = &cobra.Command{
+	Use:   "del_charger [x] [y]",
+	Short: "Deletes a charger from the warehouse",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		x, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid x coordinate: %v", err)
+		}
+		y, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid y coordinate: %v", err)
+		}
+		return warehouse.DelCharger(uint(x), uint(y))
+	},
+}
+
+// chargeCmd represents the charge command, which sends a robot to the nearest charger to fill its battery
+var chargeCmd = &cobra.Command{
+	Use:   "charge [robot_id]",
+	Short: "Send a robot to the nearest charger and fill its battery",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		robotID := args[0]
+		robot, ok := robot_map[robotID]
+		if !ok {
+			fmt.Printf("Error: Robot with ID '%s' not found.\n", robotID)
+			return
+		}
+		chargers := warehouse.Chargers()
+		if len(chargers) == 0 {
+			fmt.Println("Error: The warehouse has no chargers.")
+			return
+		}
+
+		// Nearest charger by grid distance
+		state := robot.CurrentState()
+		distance := func(p librobot.Position) uint {
+			return max(p.X, state.X) - min(p.X, state.X) + max(p.Y, state.Y) - min(p.Y, state.Y)
+		}
+		nearest := chargers[0]
+		for _, charger := range chargers[1:] {
+			if distance(charger) < distance(nearest) {
+				nearest = charger
+			}
+		}
+		if distance(nearest) > 0 {
+			taskID, commands, _, errChan := robot.MoveTo(nearest.X, nearest.Y)
+			if taskID == "" {
+				fmt.Printf("Error: No path for robot '%s' to the charger at (%d, %d): %v\n", robotID, nearest.X, nearest.Y, <-errChan)
+				return
+			}
+			fmt.Printf("Task '%s' enqueued for robot '%s' with commands \"%s\".\n", taskID, robotID, commands)
+			go reportFailure(robot, robotID, taskID)
+		}
+
+		taskID, _, errChan := robot.EnqueueTask("C")
+		if taskID == "" {
+			fmt.Printf("Error: Could not charge robot '%s': %v\n", robotID, <-errChan)
+			return
+		}
+		fmt.Printf("Task '%s' enqueued for robot '%s' to charge at (%d, %d).\n", taskID, robotID, nearest.X, nearest.Y)
+		go reportFailure(robot, robotID, taskID)
+	},
+}
+
+// batteryCmd represents the battery command, which replaces the warehouse with an empty one whose robots have batteries
+var batteryCmd = &cobra.Command{
+	Use:   "battery [capacity] [move_cost] [diagonal_move_cost] [carry_cost]",
+	Short: "Replace the warehouse with an empty one whose robots have batteries",
+	Long: `Replace the warehouse with an empty one of the same size whose robots have batteries.
+The warehouse's crates, obstacles, chargers and named locations are discarded, so set up
+batteries first, or load a map afterwards. The command is refused while the warehouse has robots.`,
+	Args: cobra.ExactArgs(4),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(robot_map) > 0 {
+			fmt.Printf("Error: The warehouse has %d robots. Remove them before setting up batteries.\n", len(robot_map))
+			return
+		}
+		var values [4]int
+		for i, arg := range args {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				fmt.Printf("Error: Invalid battery setting '%s'. Please use non-negative integers.\n", arg)
+				return
+			}
+			values[i] = n
+		}
+		if values[0] == 0 {
+			fmt.Println("Error: Battery capacity must be at least 1.")
+			return
+		}
+		model := librobot.BatteryModel{Capacity: values[0], MoveCost: values[1], DiagonalMoveCost: values[2], CarryCost: values[3]}
+
+		width, height := warehouse.Size()
+		closeWarehouse()
+		warehouse = librobot.NewCrateWarehouse(librobot.WithGridSize(width, height), librobot.WithBattery(model))
+		robot_map = make(map[string]librobot.Robot)
+		fmt.Printf("Created empty warehouse (%dx%d) whose robots have batteries of %d charge.\n", width, height, model.Capacity)
+	},
+}
+
+// batteryOptions returns the option giving the robots of a new warehouse the same batteries as the current one
+func batteryOptions() []librobot.WarehouseOption {
+	if model, ok := warehouse.Battery(); ok {
+		return []librobot.WarehouseOption{librobot.WithBattery(model)}
+	}
+	return nil
+}
+
 // cancelTaskCmd represents the cancel_task command
 var cancelTaskCmd = &cobra.Command{
 	Use:   "cancel_task [robot_id] [task_id]",
@@ -184,6 +456,276 @@ var cancelTaskCmd = &cobra.Command{
 	},
 }
 
+// listQueueCmd represents the list_queue command
+var listQueueCmd = &cobra.Command{
+	Use:   "list_queue [robot_id]",
+	Short: "List the tasks waiting in a robot's queue, in the order they will run",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		robotID := args[0]
+
+		// Get robot from map
+		robot, ok := robot_map[robotID]
+
+		if !ok {
+			fmt.Printf("Error: Robot with ID '%s' not found.\n", robotID)
+			return
+		}
+
+		queued := robot.ListQueuedTasks()
+		fmt.Printf("Robot '%s' has %d queued tasks.\n", robotID, len(queued))
+		for i, status := range queued {
+			fmt.Printf("%d. Task '%s' \"%s\" (priority %d)\n", i+1, status.ID, status.Commands, status.Priority)
+		}
+	},
+}
+
+// reorderQueueCmd represents the reorder_queue command
+var reorderQueueCmd = &cobra.Command{
+	Use:   "reorder_queue [robot_id] [task_id...]",
+	Short: "Move queued tasks to the front of a robot's queue, in the given order",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		robotID := args[0]
+
+		// Get robot from map
+		robot, ok := robot_map[robotID]
+
+		if !ok {
+			fmt.Printf("Error: Robot with ID '%s' not found.\n", robotID)
+			return
+		}
+
+		if err := robot.ReorderTasks(args[1:]); err != nil {
+			fmt.Printf("Error reordering queue: %v\n", err)
+			return
+		}
+		fmt.Printf("Queue for robot '%s' reordered.\n", robotID)
+	},
+}
+
+// clearQueueCmd represents the clear_queue command
+var clearQueueCmd = &cobra.Command{
+	Use:   "clear_queue [robot_id]",
+	Short: "Cancel every task waiting in a robot's queue",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		robotID := args[0]
+
+		// Get robot from map
+		robot, ok := robot_map[robotID]
+
+		if !ok {
+			fmt.Printf("Error: Robot with ID '%s' not found.\n", robotID)
+			return
+		}
+
+		cleared := robot.ClearQueue()
+		fmt.Printf("Cancelled %d queued tasks for robot '%s'.\n", len(cleared), robotID)
+	},
+}
+
+// pauseCmd represents the pause command
+var pauseCmd = &cobra.Command{
+	Use:   "pause [robot_id]",
+	Short: "Hold a robot, or every robot in the warehouse, in place once its current command is done",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			warehouse.Pause()
+			fmt.Println("Warehouse paused.")
+			return
+		}
+		robotID := args[0]
+
+		// Get robot from map
+		robot, ok := robot_map[robotID]
+
+		if !ok {
+			fmt.Printf("Error: Robot with ID '%s' not found.\n", robotID)
+			return
+		}
+
+		robot.Pause()
+		fmt.Printf("Robot '%s' paused.\n", robotID)
+	},
+}
+
+// resumeCmd represents the resume command
+var resumeCmd = &cobra.Command{
+	Use:   "resume [robot_id]",
+	Short: "Let a paused robot, or the paused warehouse, carry on with its tasks",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			warehouse.Resume()
+			fmt.Println("Warehouse resumed.")
+			return
+		}
+		robotID := args[0]
+
+		// Get robot from map
+		robot, ok := robot_map[robotID]
+
+		if !ok {
+			fmt.Printf("Error: Robot with ID '%s' not found.\n", robotID)
+			return
+		}
+
+		robot.Resume()
+		fmt.Printf("Robot '%s' resumed.\n", robotID)
+	},
+}
+
+// estopCmd represents the estop command, which halts every robot and prints the incident report
+var estopCmd = &cobra.Command{
+	Use:   "estop",
+	Short: "Emergency stop every robot in the warehouse, rejecting new tasks until reset",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		incident := warehouse.EmergencyStop()
+		fmt.Printf("Emergency stop at %s: %d robots halted.\n", incident.Time.Format(time.RFC3339), len(incident.Robots))
+		for _, robot := range incident.Robots {
+			fmt.Printf("Robot '%s' at (%d, %d)", robot.RobotID, robot.State.X, robot.State.Y)
+			if robot.State.HasCrate {
+				fmt.Print(" carrying a crate")
+			}
+			if robot.TaskID != "" {
+				fmt.Printf(", task '%s' interrupted after %d commands", robot.TaskID, robot.CommandsExecuted)
+			}
+			if len(robot.Cancelled) > 0 {
+				fmt.Printf(", %d queued tasks cancelled", len(robot.Cancelled))
+			}
+			fmt.Println(".")
+		}
+	},
+}
+
+// resetEstopCmd represents the reset_estop command
+var resetEstopCmd = &cobra.Command{
+	Use:   "reset_estop",
+	Short: "Clear an emergency stop, so robots accept tasks again",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, ok := warehouse.Incident(); !ok {
+			fmt.Println("Warehouse is not emergency stopped.")
+			return
+		}
+		warehouse.Reset()
+		fmt.Println("Emergency stop reset.")
+	},
+}
+
+// taskStatusCmd represents the task_status command
+var taskStatusCmd = &cobra.Command{
+	Use:   "task_status [robot_id] [task_id]",
+	Short: "Show the progress of a task",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		robotID := args[0]
+		taskID := args[1]
+
+		// Get robot from map
+		robot, ok := robot_map[robotID]
+
+		if !ok {
+			fmt.Printf("Error: Robot with ID '%s' not found.\n", robotID)
+			return
+		}
+
+		status, err := robot.TaskStatus(taskID)
+		if err != nil {
+			fmt.Printf("Error getting task status: %v\n", err)
+			return
+		}
+		fmt.Printf("Task '%s' for robot '%s' is %s (%d/%d commands executed).\n",
+			taskID, robotID, status.State, status.CommandsExecuted, status.TotalCommands)
+		if status.Priority != librobot.PriorityNormal {
+			fmt.Printf("Priority: %d\n", status.Priority)
+		}
+		if status.FailedCommand != 0 {
+			fmt.Printf("Failed on command '%c': %v\n", status.FailedCommand, status.Err)
+		}
+	},
+}
+
+// loadMapCmd represents the load_map command, which replaces the warehouse with one loaded from a layout file
+var loadMapCmd = &cobra.Command{
+	Use:   "load_map [file]",
+	Short: "Replace the warehouse with a layout loaded from a text or JSON map file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		layout, err := librobot.ReadLayout(args[0])
+		if err != nil {
+			fmt.Printf("Error reading map: %v\n", err)
+			return
+		}
+		cw, robots, err := librobot.LoadLayout(layout, batteryOptions()...)
+		if err != nil {
+			fmt.Printf("Error loading map: %v\n", err)
+			return
+		}
+
+		closeWarehouse()
+		warehouse = cw
+		robot_map = robots
+		width, height := warehouse.Size()
+		fmt.Printf("Loaded map '%s' (%dx%d) with %d robots, %d crates and %d obstacles.\n",
+			args[0], width, height, len(layout.Robots), len(layout.Crates), len(layout.Obstacles))
+	},
+}
+
+// saveCmd represents the save command, which writes a snapshot of the warehouse to a file
+var saveCmd = &cobra.Command{
+	Use:   "save [file]",
+	Short: "Save the warehouse, its robots and their pending tasks to a snapshot file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := warehouse.Snapshot()
+		if err != nil {
+			fmt.Printf("Error taking snapshot: %v\n", err)
+			return
+		}
+		if err := os.WriteFile(args[0], data, 0o644); err != nil {
+			fmt.Printf("Error saving snapshot: %v\n", err)
+			return
+		}
+		fmt.Printf("Saved warehouse with %d robots to '%s'.\n", len(robot_map), args[0])
+	},
+}
+
+// restoreCmd represents the restore command, which replaces the warehouse with one restored from a snapshot file
+var restoreCmd = &cobra.Command{
+	Use:   "restore [file]",
+	Short: "Replace the warehouse with one restored from a snapshot file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			fmt.Printf("Error reading snapshot: %v\n", err)
+			return
+		}
+		w, robots, err := librobot.Restore(data, batteryOptions()...)
+		if err != nil {
+			fmt.Printf("Error restoring snapshot: %v\n", err)
+			return
+		}
+		cw, ok := w.(librobot.CrateWarehouse)
+		if !ok {
+			ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+			defer cancel()
+			w.Close(ctx)
+			fmt.Println("Error restoring snapshot: not a crate warehouse")
+			return
+		}
+
+		closeWarehouse()
+		warehouse = cw
+		robot_map = robots
+		fmt.Printf("Restored warehouse with %d robots from '%s'.\n", len(robot_map), args[0])
+	},
+}
+
 // viewCmd starts the visualization in a separate goroutine
 var viewCmd = &cobra.Command{
 	Use:   "view",
@@ -196,12 +738,14 @@ var viewCmd = &cobra.Command{
 
 		// Re-initialize the done channel and set the running flag
 		done = make(chan bool)
+		viewStopped = make(chan struct{})
 		viewIsRunning = true
 
 		// Clear the screen once to provide a clean canvas for the view.
 		librobot.ClearScreen()
 
 		go func() {
+			defer close(viewStopped)
 			ticker := time.NewTicker(simulationTick)
 			defer ticker.Stop()
 			for {
@@ -234,23 +778,61 @@ var stopViewCmd = &cobra.Command{
 			fmt.Println("View is not running.")
 			return
 		}
-		close(done)
-		viewIsRunning = false
+		stopView()
 	},
 }
 
+// stopView signals the view goroutine to stop and waits for it, so nothing is drawn once the command returns
+func stopView() {
+	close(done)
+	<-viewStopped
+	viewIsRunning = false
+}
+
 // init function to set up Cobra commands
 func init() {
 	RootCmd.AddCommand(addRobotCmd)
 	RootCmd.AddCommand(addDiagRobotCmd)
+	RootCmd.AddCommand(removeRobotCmd)
 	RootCmd.AddCommand(addTaskCmd)
+	RootCmd.AddCommand(moveToCmd)
 	RootCmd.AddCommand(addCrateCmd)
 	RootCmd.AddCommand(delCrateCmd)
+	RootCmd.AddCommand(addChargerCmd)
+	RootCmd.AddCommand(delChargerCmd)
+	RootCmd.AddCommand(chargeCmd)
+	RootCmd.AddCommand(batteryCmd)
+	RootCmd.AddCommand(loadMapCmd)
+	RootCmd.AddCommand(saveCmd)
+	RootCmd.AddCommand(restoreCmd)
 	RootCmd.AddCommand(cancelTaskCmd)
+	RootCmd.AddCommand(taskStatusCmd)
+	RootCmd.AddCommand(listQueueCmd)
+	RootCmd.AddCommand(reorderQueueCmd)
+	RootCmd.AddCommand(clearQueueCmd)
+	RootCmd.AddCommand(pauseCmd)
+	RootCmd.AddCommand(resumeCmd)
+	RootCmd.AddCommand(estopCmd)
+	RootCmd.AddCommand(resetEstopCmd)
 	RootCmd.AddCommand(viewCmd)
 	RootCmd.AddCommand(stopViewCmd)
 }
 
+// closeWarehouse stops the warehouse's robots and reports any tasks which were abandoned
+func closeWarehouse() {
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+
+	abandoned, err := warehouse.Close(ctx)
+	for _, task := range abandoned {
+		fmt.Printf("Abandoned task '%s' for robot '%s' (%d/%d commands executed).\n",
+			task.Status.ID, task.RobotID, task.Status.CommandsExecuted, task.Status.TotalCommands)
+	}
+	if err != nil {
+		fmt.Printf("Error closing warehouse: %v\n", err)
+	}
+}
+
 func main() {
 	// Create empty warehouse for interaction
 	warehouse = librobot.NewCrateWarehouse()
@@ -279,8 +861,9 @@ func main() {
 		// for the prompt, to prevent it from being overwritten.
 		if viewIsRunning {
 			log.SetOutput(io.Discard)
-			// Calculate the row for the prompt: GridSize + header (4 lines)
-			promptRow := librobot.GridSize + 4
+			// Calculate the row for the prompt: grid height + header (4 lines)
+			_, height := warehouse.Size()
+			promptRow := int(height) + 4
 			// Move cursor to the calculated row, column 0, and clear the line
 			fmt.Printf("\033[%d;0H\033[K", promptRow)
 		}
@@ -305,8 +888,9 @@ func main() {
 		if strings.ToLower(input) == "exit" {
 			// Signal the view to stop before exiting
 			if viewIsRunning {
-				close(done)
+				stopView()
 			}
+			closeWarehouse()
 			fmt.Println("Exiting interactive CLI. Goodbye!")
 			return
 		}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -325,6 +327,580 @@ func TestAddTask(t *testing.T) {
 	if !strings.Contains(output, expectedOutputPrefix) {
 		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutputPrefix, output)
 	}
+
+	// Test Task with an invalid command
+	restoreOutput = captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"add_task", "r1", "N", "X", "N"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("add_task command failed: %v", err)
+	}
+
+	output = restoreOutput()
+	expectedOutputPrefix = "Error: Task rejected for robot 'r1': invalid command 'X' at offset 1"
+	if !strings.Contains(output, expectedOutputPrefix) {
+		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutputPrefix, output)
+	}
+}
+
+// TestAddTaskPriority tests the priority and preemption options of the "add_task" command.
+func TestAddTaskPriority(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	// Use a fake clock so the first task is still running
+	clock := librobot.NewFakeClock(time.Now())
+	warehouse = librobot.NewCrateWarehouse(librobot.WithClock(clock))
+	robot, err := librobot.AddRobot(warehouse, 0, 0, "r1")
+	if err != nil {
+		t.Fatalf("Failed to add robot: %v", err)
+	}
+	robot_map["r1"] = robot
+	robot.EnqueueTask("N N N")
+	clock.BlockUntil(1)
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"add_task", "r1", "E", "E", "priority=2", "preempt=suspend"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("add_task command failed: %v", err)
+	}
+
+	output := restoreOutput()
+	_, taskID, _ := strings.Cut(output, "Task '")
+	taskID, _, _ = strings.Cut(taskID, "'")
+	status, err := robot.TaskStatus(taskID)
+	if err != nil {
+		t.Fatalf("Expected task to be enqueued, but got:\n%s", output)
+	}
+	if status.Commands != "EE" || status.Priority != librobot.PriorityUrgent {
+		t.Errorf("Expected commands \"EE\" with priority 2, got %+v", status)
+	}
+
+	// The priority is shown by task_status
+	restoreOutput = captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"task_status", "r1", taskID})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("task_status command failed: %v", err)
+	}
+
+	output = restoreOutput()
+	expectedOutput := "Priority: 2"
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+	}
+
+	// Unknown preemption mode
+	restoreOutput = captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"add_task", "r1", "E", "preempt=later"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("add_task command failed: %v", err)
+	}
+
+	output = restoreOutput()
+	expectedOutput = "Error: unknown preemption mode 'later'"
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+	}
+}
+
+// TestQueueCommands tests the "list_queue", "reorder_queue" and "clear_queue" commands.
+func TestQueueCommands(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	// Use a fake clock so the tasks stay queued behind the first task
+	clock := librobot.NewFakeClock(time.Now())
+	warehouse = librobot.NewCrateWarehouse(librobot.WithClock(clock))
+	robot, err := librobot.AddRobot(warehouse, 0, 0, "r1")
+	if err != nil {
+		t.Fatalf("Failed to add robot: %v", err)
+	}
+	robot_map["r1"] = robot
+	robot.EnqueueTask("N N N")
+	clock.BlockUntil(1)
+	first, _, _ := robot.EnqueueTask("E")
+	second, _, _ := robot.EnqueueTask("E E")
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"reorder_queue", "r1", second})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("reorder_queue command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"list_queue", "r1"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("list_queue command failed: %v", err)
+	}
+
+	output := restoreOutput()
+	for _, expectedOutput := range []string{
+		"Queue for robot 'r1' reordered.",
+		"Robot 'r1' has 2 queued tasks.",
+		"1. Task '" + second + "' \"E E\" (priority 0)",
+		"2. Task '" + first + "' \"E\" (priority 0)",
+	} {
+		if !strings.Contains(output, expectedOutput) {
+			t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+		}
+	}
+
+	// Unknown task
+	restoreOutput = captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"reorder_queue", "r1", "unknown"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("reorder_queue command failed: %v", err)
+	}
+
+	output = restoreOutput()
+	expectedOutput := "Error reordering queue:"
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+	}
+
+	// Clearing cancels the queued tasks
+	restoreOutput = captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"clear_queue", "r1"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("clear_queue command failed: %v", err)
+	}
+
+	output = restoreOutput()
+	expectedOutput = "Cancelled 2 queued tasks for robot 'r1'."
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+	}
+	if queued := robot.ListQueuedTasks(); len(queued) != 0 {
+		t.Errorf("Expected an empty queue, got %d tasks", len(queued))
+	}
+}
+
+// TestPauseCommands tests the "pause" and "resume" commands, for a robot and for the whole warehouse.
+func TestPauseCommands(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	// Use a fake clock to tell whether the robot carries on with its task
+	clock := librobot.NewFakeClock(time.Now())
+	warehouse = librobot.NewCrateWarehouse(librobot.WithClock(clock))
+	robot, err := librobot.AddRobot(warehouse, 0, 0, "r1")
+	if err != nil {
+		t.Fatalf("Failed to add robot: %v", err)
+	}
+	robot_map["r1"] = robot
+	taskID, _, _ := robot.EnqueueTask("E E")
+	clock.BlockUntil(1)
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"pause"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("pause command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"pause", "r1"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("pause command failed: %v", err)
+	}
+	clock.Advance(librobot.CommandExecutionTime)
+	time.Sleep(50 * time.Millisecond)
+	if status, _ := robot.TaskStatus(taskID); status.CommandsExecuted != 1 || clock.Waiters() != 0 {
+		t.Errorf("Expected the paused robot to hold after 1 command, got %+v", status)
+	}
+
+	RootCmd.SetArgs([]string{"resume"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("resume command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"resume", "r1"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("resume command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"pause", "unknown"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("pause command failed: %v", err)
+	}
+
+	output := restoreOutput()
+	for _, expectedOutput := range []string{
+		"Warehouse paused.",
+		"Robot 'r1' paused.",
+		"Warehouse resumed.",
+		"Robot 'r1' resumed.",
+		"Error: Robot with ID 'unknown' not found.",
+	} {
+		if !strings.Contains(output, expectedOutput) {
+			t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+		}
+	}
+
+	// Once resumed, the robot carries on with its second command
+	clock.BlockUntil(1)
+	clock.Advance(librobot.CommandExecutionTime)
+	if state := robot.CurrentState(); state.X != 2 {
+		t.Errorf("Expected robot at x=2 after resuming, got %d", state.X)
+	}
+}
+
+// TestEmergencyStop tests the "estop" and "reset_estop" commands.
+func TestEmergencyStop(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	// Use a fake clock so the task is running when the warehouse is stopped
+	clock := librobot.NewFakeClock(time.Now())
+	warehouse = librobot.NewCrateWarehouse(librobot.WithClock(clock))
+	robot, err := librobot.AddRobot(warehouse, 0, 0, "r1")
+	if err != nil {
+		t.Fatalf("Failed to add robot: %v", err)
+	}
+	robot_map["r1"] = robot
+	taskID, _, _ := robot.EnqueueTask("N N N")
+	clock.BlockUntil(1)
+	robot.EnqueueTask("E")
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"estop"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("estop command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"add_task", "r1", "E"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("add_task command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"reset_estop"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("reset_estop command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"reset_estop"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("reset_estop command failed: %v", err)
+	}
+
+	output := restoreOutput()
+	for _, expectedOutput := range []string{
+		"1 robots halted.",
+		"Robot 'r1' at (0, 1), task '" + taskID + "' interrupted after 1 commands, 1 queued tasks cancelled.",
+		librobot.ErrEmergencyStop.Error(),
+		"Emergency stop reset.",
+		"Warehouse is not emergency stopped.",
+	} {
+		if !strings.Contains(output, expectedOutput) {
+			t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if result, err := robot.Wait(ctx, taskID); err != nil || result.State != librobot.TaskInterrupted {
+		t.Errorf("Expected the running task to be interrupted, got %+v, %v", result, err)
+	}
+}
+
+// TestMoveTo tests the "move_to" command.
+func TestMoveTo(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	RootCmd.SetArgs([]string{"add_robot", "r1", "0", "0"})
+	RootCmd.Execute()
+	RootCmd.SetArgs([]string{"add_robot", "r2", "1", "0"})
+	RootCmd.Execute()
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"move_to", "r1", "2", "0"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("move_to command failed: %v", err)
+	}
+
+	output := restoreOutput()
+	expectedOutput := "enqueued for robot 'r1' with commands \"N E E S\"."
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+	}
+
+	// Occupied target
+	restoreOutput = captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"move_to", "r1", "1", "0"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("move_to command failed: %v", err)
+	}
+
+	output = restoreOutput()
+	expectedOutput = "Error: No path for robot 'r1' to (1, 0): target position already occupied by another robot"
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+	}
+}
+
+// TestLoadMap tests the "load_map" command and moving to a named location.
+func TestLoadMap(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	path := filepath.Join(t.TempDir(), "site.txt")
+	layout := " - ### - \nr1### - \n - [C] - \nlocation dock 2 2\n"
+	if err := os.WriteFile(path, []byte(layout), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	// The replaced warehouse is closed, abandoning its robot's task
+	RootCmd.SetArgs([]string{"add_robot", "r0", "0", "0"})
+	RootCmd.Execute()
+	RootCmd.SetArgs([]string{"add_task", "r0", "NNNN"})
+	RootCmd.Execute()
+
+	RootCmd.SetArgs([]string{"load_map", path})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("load_map command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"move_to", "r1", "dock"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("move_to command failed: %v", err)
+	}
+
+	output := restoreOutput()
+	for _, expectedOutput := range []string{
+		"for robot 'r0' (",
+		"with 1 robots, 1 crates and 2 obstacles.",
+		"enqueued for robot 'r1' with commands \"S E E N N\".",
+	} {
+		if !strings.Contains(output, expectedOutput) {
+			t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+		}
+	}
+	if width, height := warehouse.Size(); width != 3 || height != 3 {
+		t.Errorf("Expected a 3x3 warehouse, got %dx%d", width, height)
+	}
+
+	// A missing file leaves the warehouse in place
+	restoreOutput = captureOutput()
+	defer restoreOutput()
+	RootCmd.SetArgs([]string{"load_map", filepath.Join(t.TempDir(), "missing.txt")})
+	RootCmd.Execute()
+	if output := restoreOutput(); !strings.Contains(output, "Error reading map:") {
+		t.Errorf("Expected a read error, got:\n%s", output)
+	}
+	if _, ok := robot_map["r1"]; !ok {
+		t.Error("Expected robots from the loaded map to remain")
+	}
+}
+
+// TestBatteryCommands tests creating a warehouse with batteries, managing chargers and charging robots
+func TestBatteryCommands(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	// Robots are not thrown away with the old warehouse
+	RootCmd.SetArgs([]string{"add_robot", "r0", "1", "1"})
+	RootCmd.Execute()
+	RootCmd.SetArgs([]string{"battery", "10", "2", "3", "1"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("battery command failed: %v", err)
+	}
+	if _, ok := warehouse.Battery(); ok || len(robot_map) != 1 {
+		t.Errorf("Expected the warehouse to be kept while it has robots, got batteries %v and %d robots", ok, len(robot_map))
+	}
+	RootCmd.SetArgs([]string{"remove_robot", "r0"})
+	RootCmd.Execute()
+
+	RootCmd.SetArgs([]string{"battery", "10", "2", "3", "1"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("battery command failed: %v", err)
+	}
+	if model, ok := warehouse.Battery(); !ok || model.Capacity != 10 || model.CarryCost != 1 {
+		t.Errorf("Expected a warehouse with batteries, got %+v, %v", model, ok)
+	}
+
+	// Use a fake clock so the robot's progress can be followed
+	clock := librobot.NewFakeClock(time.Now())
+	warehouse = librobot.NewCrateWarehouse(librobot.WithClock(clock), librobot.WithBattery(librobot.BatteryModel{Capacity: 10, MoveCost: 2}))
+	robot, err := librobot.AddRobot(warehouse, 0, 2, "r1")
+	if err != nil {
+		t.Fatalf("Failed to add robot: %v", err)
+	}
+	robot_map["r1"] = robot
+
+	RootCmd.SetArgs([]string{"charge", "r1"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("charge command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"add_charger", "0", "0"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("add_charger command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"add_charger", "0", "0"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("add_charger command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"charge", "r1"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("charge command failed: %v", err)
+	}
+	for range 3 {
+		clock.BlockUntil(1)
+		clock.Advance(librobot.CommandExecutionTime)
+	}
+	deadline := time.Now().Add(time.Second)
+	for robot.CurrentState() != (librobot.RobotState{X: 0, Y: 0, Battery: 10}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected r1 charged at (0, 0), got %+v", robot.CurrentState())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	RootCmd.SetArgs([]string{"del_charger", "0", "0"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("del_charger command failed: %v", err)
+	}
+	RootCmd.SetArgs([]string{"del_charger", "0", "0"})
+	if err := RootCmd.Execute(); err == nil {
+		t.Error("Expected del_charger to fail for a missing charger")
+	}
+
+	output := restoreOutput()
+	for _, expectedOutput := range []string{
+		"Created empty warehouse (10x10) whose robots have batteries of 10 charge.",
+		"Error: The warehouse has no chargers.",
+		"Charger added at (0, 0).",
+		"Error adding charger: " + librobot.ErrChargerExists.Error(),
+		"with commands \"S S\".",
+		"to charge at (0, 0).",
+	} {
+		if !strings.Contains(output, expectedOutput) {
+			t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+		}
+	}
+}
+
+// TestSaveRestore tests the "save" and "restore" commands.
+func TestSaveRestore(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	RootCmd.SetArgs([]string{"add_robot", "r1", "1", "1"})
+	RootCmd.Execute()
+	RootCmd.SetArgs([]string{"add_crate", "2", "2"})
+	RootCmd.Execute()
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"save", path})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("save command failed: %v", err)
+	}
+
+	// Start again from an empty warehouse
+	setupTest()
+	RootCmd.SetArgs([]string{"restore", path})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("restore command failed: %v", err)
+	}
+
+	output := restoreOutput()
+	for _, expectedOutput := range []string{
+		"Saved warehouse with 1 robots to",
+		"Restored warehouse with 1 robots from",
+	} {
+		if !strings.Contains(output, expectedOutput) {
+			t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+		}
+	}
+	robot, ok := robot_map["r1"]
+	if !ok {
+		t.Fatal("Expected robot 'r1' to be restored")
+	}
+	if state := robot.CurrentState(); state.X != 1 || state.Y != 1 {
+		t.Errorf("Expected robot at (1, 1), got (%d, %d)", state.X, state.Y)
+	}
+	if err := warehouse.AddCrate(2, 2); err != librobot.ErrCrateExists {
+		t.Errorf("Expected crate at (2, 2) to be restored, got %v", err)
+	}
+}
+
+// TestRemoveRobot tests the "remove_robot" command.
+func TestRemoveRobot(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	RootCmd.SetArgs([]string{"add_robot", "r1", "1", "1"})
+	RootCmd.Execute()
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	for _, args := range [][]string{
+		{"remove_robot", "r1", "later"},
+		{"remove_robot", "r9"},
+		{"remove_robot", "r1", "drain"},
+	} {
+		RootCmd.SetArgs(args)
+		if err := RootCmd.Execute(); err != nil {
+			t.Fatalf("remove_robot command failed: %v", err)
+		}
+	}
+
+	output := restoreOutput()
+	for _, expectedOutput := range []string{
+		"Error: Unknown option 'later'",
+		"Error: Robot with ID 'r9' not found.",
+		"Removed robot 'r1'.",
+	} {
+		if !strings.Contains(output, expectedOutput) {
+			t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+		}
+	}
+	if _, ok := robot_map["r1"]; ok || len(warehouse.Robots()) != 0 {
+		t.Error("Expected robot 'r1' to be removed")
+	}
+}
+
+// TestCloseWarehouse tests the warehouse is closed on exit, reporting abandoned tasks.
+func TestCloseWarehouse(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	RootCmd.SetArgs([]string{"add_robot", "r1", "1", "1"})
+	RootCmd.Execute()
+	RootCmd.SetArgs([]string{"add_task", "r1", "NNNN"})
+	RootCmd.Execute()
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+	closeWarehouse()
+
+	output := restoreOutput()
+	expectedOutput := "for robot 'r1' ("
+	if !strings.Contains(output, "Abandoned task") || !strings.Contains(output, expectedOutput) {
+		t.Errorf("Expected output to report the abandoned task, but got:\n%s", output)
+	}
+	if _, err := librobot.AddRobot(warehouse, 2, 2, "r2"); err != librobot.ErrWarehouseClosed {
+		t.Errorf("Expected %v, got %v", librobot.ErrWarehouseClosed, err)
+	}
 }
 
 // TestViewCommands tests the "view" and "stop_view" commands.
@@ -369,3 +945,49 @@ func TestViewCommands(t *testing.T) {
 	}()
 	wg.Wait()
 }
+
+// TestTaskStatus tests the "task_status" command.
+func TestTaskStatus(t *testing.T) {
+	setupTest()
+	defer setupTest()
+
+	// Use a fake clock so the task is held after its first command
+	clock := librobot.NewFakeClock(time.Now())
+	warehouse = librobot.NewCrateWarehouse(librobot.WithClock(clock))
+	robot, err := librobot.AddRobot(warehouse, 0, 0, "r1")
+	if err != nil {
+		t.Fatalf("Failed to add robot: %v", err)
+	}
+	robot_map["r1"] = robot
+	taskID, _, _ := robot.EnqueueTask("N N N")
+	clock.BlockUntil(1)
+
+	restoreOutput := captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"task_status", "r1", taskID})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("task_status command failed: %v", err)
+	}
+
+	output := restoreOutput()
+	expectedOutput := "is running (1/3 commands executed)."
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+	}
+
+	// Unknown task
+	restoreOutput = captureOutput()
+	defer restoreOutput()
+
+	RootCmd.SetArgs([]string{"task_status", "r1", "unknown"})
+	if err := RootCmd.Execute(); err != nil {
+		t.Fatalf("task_status command failed: %v", err)
+	}
+
+	output = restoreOutput()
+	expectedOutput = "Error getting task status: task not found"
+	if !strings.Contains(output, expectedOutput) {
+		t.Errorf("Expected output to contain '%s', but got:\n%s", expectedOutput, output)
+	}
+}